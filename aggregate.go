@@ -0,0 +1,258 @@
+package sqi
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ------------------------------------------------------------
+// BUILT-INS (aggregates)
+
+// Each aggregate takes a collection and an optional path that is
+// evaluated on every item, i.e. sum(/Orders, /Total). Nil values
+// are skipped.
+
+// builtinCount() answers the number of items. With a path, it answers
+// the number of items where the path is something other than nil or false.
+func builtinCount(items interface{}, path ...Expr) (int, error) {
+	values, err := aggregateValues("count", items, path)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, v := range values {
+		if b, ok := v.(bool); v != nil && (!ok || b) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// builtinSum() answers the sum of the numbers, which can be any kind. The
+// sum is an int if every number is an int, an int64 if every number is an
+// integer, otherwise it's a float64.
+func builtinSum(items interface{}, path ...Expr) (interface{}, error) {
+	values, err := aggregateValues("sum", items, path)
+	if err != nil {
+		return nil, err
+	}
+	isum, fsum, isfloat, isint := int64(0), 0.0, false, true
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if i, ok := toInt64(v); ok && !isfloat {
+			isum += i
+			if _, ok := v.(int); !ok {
+				isint = false
+			}
+			continue
+		}
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, errors.New("sum must have numbers, not " + typeName(v))
+		}
+		if !isfloat {
+			fsum, isfloat = float64(isum), true
+		}
+		fsum += f
+	}
+	if isfloat {
+		return fsum, nil
+	} else if isint {
+		return int(isum), nil
+	}
+	return isum, nil
+}
+
+// builtinAvg() answers the average of the numbers as a float64, or nil if
+// there are no numbers.
+func builtinAvg(items interface{}, path ...Expr) (interface{}, error) {
+	values, err := aggregateValues("avg", items, path)
+	if err != nil {
+		return nil, err
+	}
+	sum, count := 0.0, 0
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		f, ok := toFloat64(v)
+		if !ok {
+			return nil, errors.New("avg must have numbers, not " + typeName(v))
+		}
+		sum += f
+		count++
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	return sum / float64(count), nil
+}
+
+// builtinMin() answers the smallest number or string, or nil if there are none.
+func builtinMin(items interface{}, path ...Expr) (interface{}, error) {
+	values, err := aggregateValues("min", items, path)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateBest(values, -1)
+}
+
+// builtinMax() answers the largest number or string, or nil if there are none.
+func builtinMax(items interface{}, path ...Expr) (interface{}, error) {
+	values, err := aggregateValues("max", items, path)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateBest(values, 1)
+}
+
+// ------------------------------------------------------------
+// BUILT-INS (grouping)
+
+// builtinDistinct() answers the items with duplicates removed, keeping
+// the first of each. With a path, it answers the distinct values of the
+// path instead. Values are compared the same as the == operator.
+func builtinDistinct(items interface{}, path ...Expr) (interface{}, error) {
+	if len(path) > 0 {
+		values, err := aggregateValues("distinct", items, path)
+		if err != nil {
+			return nil, err
+		}
+		var found []interface{}
+		for _, v := range values {
+			if aggregateIndex(found, v) < 0 {
+				found = append(found, v)
+			}
+		}
+		return gather(found), nil
+	}
+
+	v := indirectValue(reflect.ValueOf(items))
+	values, err := aggregateValues("distinct", items, nil)
+	if err != nil || values == nil {
+		return nil, err
+	}
+	var found []interface{}
+	dst := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, 0)
+	for i, value := range values {
+		if aggregateIndex(found, value) < 0 {
+			found = append(found, value)
+			dst = reflect.Append(dst, v.Index(i))
+		}
+	}
+	return dst.Interface(), nil
+}
+
+// builtinGroupBy() answers a map from each distinct value of the path to
+// the items with that value, in a slice of the same element type. If every
+// value is the same type the map key is that type, otherwise it's interface{}.
+// Values are compared the same as the == operator.
+func builtinGroupBy(items interface{}, path Expr) (interface{}, error) {
+	values, err := aggregateValues("groupBy", items, []Expr{path})
+	if err != nil || values == nil {
+		return nil, err
+	}
+	v := indirectValue(reflect.ValueOf(items))
+	var keys []interface{}
+	var groups []reflect.Value
+	for i, value := range values {
+		idx := aggregateIndex(keys, value)
+		if idx < 0 {
+			idx = len(keys)
+			keys = append(keys, value)
+			groups = append(groups, reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, 0))
+		}
+		groups[idx] = reflect.Append(groups[idx], v.Index(i))
+	}
+
+	keytype := reflect.TypeOf(gather(keys)).Elem()
+	if !keytype.Comparable() {
+		return nil, errors.New("groupBy can't use " + keytype.String() + " as a key")
+	}
+	ans := reflect.MakeMapWithSize(reflect.MapOf(keytype, reflect.SliceOf(v.Type().Elem())), len(keys))
+	for i, key := range keys {
+		kv := reflect.Zero(keytype)
+		if key != nil {
+			// Json values are interface{}, so check each one can be hashed.
+			kv = reflect.ValueOf(key)
+			if !kv.Comparable() {
+				return nil, errors.New("groupBy can't use " + kv.Type().String() + " as a key")
+			}
+		}
+		ans.SetMapIndex(kv, groups[i])
+	}
+	return ans.Interface(), nil
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// aggregateValues() answers the items of a collection, or the
+// result of evaluating the path on each item. A nil collection
+// has no items.
+func aggregateValues(name string, items interface{}, path []Expr) ([]interface{}, error) {
+	if len(path) > 1 {
+		return nil, errors.New(name + " must have at most one path")
+	}
+	v := indirectValue(reflect.ValueOf(items))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Array, reflect.Slice:
+	default:
+		return nil, errors.New(name + " must have array or slice")
+	}
+	values := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := valueInterface(v.Index(i))
+		if len(path) > 0 {
+			var err error
+			item, err = path[0].Eval(item, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		values = append(values, item)
+	}
+	return values, nil
+}
+
+// aggregateIndex() answers the index of the first value equal to v, or -1.
+// Values that the == operator can't compare are compared deeply.
+func aggregateIndex(values []interface{}, v interface{}) int {
+	for i, value := range values {
+		eq, err := interfacesEqual(value, v, false)
+		if err != nil {
+			eq = reflect.DeepEqual(value, v)
+		}
+		if eq {
+			return i
+		}
+	}
+	return -1
+}
+
+// aggregateBest() answers the value that compares as dir (-1 for
+// the smallest, 1 for the largest) against all others.
+func aggregateBest(values []interface{}, dir int) (interface{}, error) {
+	var best interface{}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if best == nil {
+			best = v
+			continue
+		}
+		cmp, err := interfacesCompare(v, best, false)
+		if err != nil {
+			return nil, err
+		}
+		if cmp == dir {
+			best = v
+		}
+	}
+	return best, nil
+}
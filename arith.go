@@ -0,0 +1,139 @@
+package sqi
+
+import (
+	"math"
+	"reflect"
+)
+
+// arithmetic() answers the result of applying the arithmetic operator op
+// to a and b, which can be numbers of any kind. Two integers answer an int
+// if both are ints, otherwise an int64; anything involving floats answers
+// a float64. If strict is true, numbers must be of the same type. If it's
+// false, mixed numbers are converted, and non-numbers answer nil.
+func arithmetic(op symbol, a, b interface{}, strict bool) (interface{}, error) {
+	af, aok := toFloat64(a)
+	bf, bok := toFloat64(b)
+	if !aok || !bok || (strict && reflect.TypeOf(a) != reflect.TypeOf(b)) {
+		if !strict {
+			return nil, nil
+		}
+		return nil, newMismatchError("types " + typeName(a) + " and " + typeName(b))
+	}
+	ai, aok := toInt64(a)
+	bi, bok := toInt64(b)
+	if !aok || !bok {
+		return floatArithmetic(op, af, bf)
+	}
+	ans, err := intArithmetic(op, ai, bi)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := a.(int); ok {
+		if _, ok := b.(int); ok {
+			return int(ans), nil
+		}
+	}
+	return ans, nil
+}
+
+// negate() answers the negative of a number, which is the same type
+// unless it's unsigned. If strict is false, non-numbers answer nil.
+func negate(a interface{}, strict bool) (interface{}, error) {
+	v := reflect.ValueOf(a)
+	switch {
+	case isIntKind(v.Kind()):
+		neg := reflect.New(v.Type()).Elem()
+		neg.SetInt(-v.Int())
+		return neg.Interface(), nil
+	case isFloatKind(v.Kind()):
+		neg := reflect.New(v.Type()).Elem()
+		neg.SetFloat(-v.Float())
+		return neg.Interface(), nil
+	case isUintKind(v.Kind()):
+		// Unsigned numbers can't be negative, so they answer an int64.
+		if i, ok := toInt64(a); ok {
+			return -i, nil
+		}
+		return -float64(v.Uint()), nil
+	}
+	if !strict {
+		return nil, nil
+	}
+	return nil, newMismatchError("can't negate " + typeName(a))
+}
+
+// ------------------------------------------------------------
+// MISC
+
+func intArithmetic(op symbol, a, b int64) (int64, error) {
+	switch op {
+	case addToken:
+		return a + b, nil
+	case negToken:
+		return a - b, nil
+	case starToken:
+		return a * b, nil
+	case divToken:
+		if b == 0 {
+			return 0, newEvalError("division by zero")
+		}
+		return a / b, nil
+	case modToken:
+		if b == 0 {
+			return 0, newEvalError("division by zero")
+		}
+		return a % b, nil
+	}
+	return 0, newUnhandledError("arithmetic " + tokenMap[op].Text)
+}
+
+func floatArithmetic(op symbol, a, b float64) (interface{}, error) {
+	switch op {
+	case addToken:
+		return a + b, nil
+	case negToken:
+		return a - b, nil
+	case starToken:
+		return a * b, nil
+	case divToken:
+		if b == 0 {
+			return nil, newEvalError("division by zero")
+		}
+		return a / b, nil
+	case modToken:
+		if b == 0 {
+			return nil, newEvalError("division by zero")
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, newUnhandledError("arithmetic " + tokenMap[op].Text)
+}
+
+// toFloat64() converts a number of any kind to a float64.
+func toFloat64(i interface{}) (float64, bool) {
+	v := reflect.ValueOf(i)
+	if !isNumberKind(v.Kind()) {
+		return 0, false
+	}
+	return floatValue(v), true
+}
+
+// toInt64() converts an integer of any kind to an int64, if it fits.
+func toInt64(i interface{}) (int64, bool) {
+	v := reflect.ValueOf(i)
+	switch {
+	case isIntKind(v.Kind()):
+		return v.Int(), true
+	case isUintKind(v.Kind()) && v.Uint() <= math.MaxInt64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// typeName() answers a name for the type of i, including nil.
+func typeName(i interface{}) string {
+	if i == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(i).String()
+}
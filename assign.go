@@ -0,0 +1,288 @@
+package sqi
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// ------------------------------------------------------------
+// ASSIGNER
+
+// assigner is implemented by AST nodes that can locate values for assignment.
+type assigner interface {
+	// refs answers a reference to every value I locate in the input.
+	refs(input refT, opt *Opt, scope scopeT) ([]refT, error)
+}
+
+// ------------------------------------------------------------
+// ASSIGN-NODE
+
+// assignNode sets every value located by the lhs to the result
+// of the rhs, answering the number of values that were set.
+type assignNode struct {
+	Lhs assigner
+	Rhs AstNode
+}
+
+func (n *assignNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval assignNode", n.Lhs, n.Rhs)
+	if n.Lhs == nil || n.Rhs == nil {
+		return nil, newMalformedError("assign node")
+	}
+	rhs, err := n.Rhs.Eval(_i, opt, scope)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := n.Lhs.refs(refT{v: reflect.ValueOf(_i)}, opt, scope)
+	if err != nil {
+		return nil, err
+	}
+	strict := false
+	if opt != nil {
+		strict = opt.Strict
+	}
+	count := 0
+	for _, r := range refs {
+		err = r.set(rhs, strict)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ------------------------------------------------------------
+// ARRAY-NODE (assigning)
+
+func (n *arrayNode) refs(input refT, opt *Opt, scope scopeT) ([]refT, error) {
+	lhs := []refT{input}
+	if n.Lhs != nil {
+		a, ok := n.Lhs.(assigner)
+		if !ok {
+			return nil, newBadRequestError("operator [] can't assign")
+		}
+		var err error
+		lhs, err = a.refs(input, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ans []refT
+	for _, r := range lhs {
+		v := indirectValue(r.get())
+		switch v.Kind() {
+		case reflect.Map:
+			if key, ok := mapKey(v, strconv.Itoa(n.Index)); ok {
+				ans = append(ans, refT{m: v, key: key})
+			}
+		case reflect.Array, reflect.Slice:
+			index := n.Index
+			if index < 0 {
+				index += v.Len()
+			}
+			if index >= 0 && index < v.Len() {
+				ans = append(ans, refT{v: v.Index(index)})
+			}
+		}
+	}
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// FIELD-NODE (assigning)
+
+func (n *fieldNode) refs(input refT, opt *Opt, scope scopeT) ([]refT, error) {
+	if len(n.Field) < 1 {
+		return nil, newMalformedError("field node")
+	}
+	v := indirectValue(input.get())
+	switch v.Kind() {
+	case reflect.Invalid:
+		_, err := nilResult("/"+n.Field, opt)
+		return nil, err
+	case reflect.Array, reflect.Slice:
+		// Every item is assigned.
+		var ans []refT
+		for i := 0; i < v.Len(); i++ {
+			if !indirectValue(v.Index(i)).IsValid() {
+				if _, err := nilResult("/"+n.Field, opt); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			found, err := n.refs(refT{v: v.Index(i)}, opt, scope)
+			if err != nil {
+				return nil, err
+			}
+			ans = append(ans, found...)
+		}
+		return ans, nil
+	case reflect.Map:
+		key, ok := mapKey(v, n.Field)
+		if !ok {
+			return nil, newMismatchError("map key " + v.Type().Key().String() + " for " + n.Field)
+		}
+		// Assign to an existing key that differs only by case, instead of adding one.
+		if opt.IgnoreCase && !v.MapIndex(key).IsValid() {
+			found, err := findMapKey(v, n.Field, opt)
+			if err != nil {
+				return nil, err
+			}
+			if found.IsValid() {
+				key = found
+			}
+		}
+		return []refT{refT{m: v, key: key}}, nil
+	case reflect.Struct:
+		f, err := findField(v, n.Field, opt)
+		if err != nil {
+			return nil, err
+		}
+		if !f.IsValid() {
+			return nil, newEvalError("no field for " + n.Field)
+		}
+		return []refT{refT{v: f}}, nil
+	}
+	return nil, newEvalError("no field for " + n.Field)
+}
+
+// ------------------------------------------------------------
+// PATH-NODE (assigning)
+
+func (n *pathNode) refs(input refT, opt *Opt, scope scopeT) ([]refT, error) {
+	field, ok := n.Field.(assigner)
+	if !ok {
+		return nil, newBadRequestError("path can't assign")
+	}
+	lhs := []refT{input}
+	if n.Child != nil {
+		child, ok := n.Child.(assigner)
+		if !ok {
+			return nil, newBadRequestError("path can't assign")
+		}
+		var err error
+		lhs, err = child.refs(input, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ans []refT
+	for _, r := range lhs {
+		found, err := field.refs(r, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		ans = append(ans, found...)
+	}
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// SELECT-NODE (assigning)
+
+func (n *selectNode) refs(input refT, opt *Opt, scope scopeT) ([]refT, error) {
+	if n.Child == nil {
+		return nil, newMalformedError("select node")
+	}
+	var ans []refT
+	v := indirectValue(input.get())
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			b, err := n.isTrue(valueInterface(item), opt, scopeT{key: reflect.ValueOf(i)})
+			if err != nil {
+				return nil, err
+			}
+			if b {
+				ans = append(ans, refT{v: item})
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedMapKeys(v) {
+			b, err := n.isTrue(valueInterface(v.MapIndex(key)), opt, scopeT{key: key})
+			if err != nil {
+				return nil, err
+			}
+			if b {
+				ans = append(ans, refT{m: v, key: key})
+			}
+		}
+	}
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// UNARY-NODE (assigning)
+
+func (n *unaryNode) refs(input refT, opt *Opt, scope scopeT) ([]refT, error) {
+	child, ok := n.Child.(assigner)
+	if !ok || n.Op != openToken {
+		return nil, newBadRequestError("unary can't assign")
+	}
+	return child.refs(input, opt, scope)
+}
+
+// ------------------------------------------------------------
+// REF-T
+
+// refT is a reference to a value that can be assigned. Map
+// values can't be addressed, so they're referenced by map and key.
+type refT struct {
+	v   reflect.Value
+	m   reflect.Value // Optional -- if valid then I refer to m[key]
+	key reflect.Value
+}
+
+// get() answers the current value.
+func (r refT) get() reflect.Value {
+	if r.m.IsValid() {
+		return r.m.MapIndex(r.key)
+	}
+	return r.v
+}
+
+// set() assigns src to my value.
+func (r refT) set(src interface{}, strict bool) error {
+	if r.m.IsValid() {
+		if r.m.IsNil() {
+			return newEvalError("can't assign to nil map")
+		}
+		val, err := assignableValue(src, r.m.Type().Elem(), strict)
+		if err != nil {
+			return err
+		}
+		r.m.SetMapIndex(r.key, val)
+		return nil
+	}
+	if !r.v.CanSet() {
+		return newEvalError("can't assign to unaddressable value (use a pointer)")
+	}
+	val, err := assignableValue(src, r.v.Type(), strict)
+	if err != nil {
+		return err
+	}
+	r.v.Set(val)
+	return nil
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// assignableValue() answers src as a value that can be assigned to
+// type rt. Unless strict, numbers are converted between types, which
+// is an error if the value doesn't fit, as in convertNumber().
+func assignableValue(src interface{}, rt reflect.Type, strict bool) (reflect.Value, error) {
+	if src == nil {
+		return reflect.Zero(rt), nil
+	}
+	v := reflect.ValueOf(src)
+	if v.Type().AssignableTo(rt) {
+		return v, nil
+	}
+	if !strict && isNumberKind(v.Kind()) && isNumberKind(rt.Kind()) {
+		return convertNumber(v, rt, "")
+	}
+	return reflect.Value{}, newMismatchError("can't assign " + v.Type().String() + " to " + rt.String())
+}
@@ -1,9 +1,11 @@
 package sqi
 
 import (
-	"errors"
+	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"sync/atomic"
 )
 
 // ------------------------------------------------------------
@@ -13,51 +15,66 @@ import (
 type AstNode interface {
 	// Evaluate the interface, returning the results. This is intended
 	// to  be only an internal API: the Opt* is a pointer but can not be nil.
-	Eval(interface{}, *Opt) (interface{}, error)
+	Eval(interface{}, *Opt, scopeT) (interface{}, error)
+}
+
+// ------------------------------------------------------------
+// SCOPE-T
+
+// scopeT is the state of the item being selected, which @key answers.
+// It's kept out of Opt, which belongs to the caller.
+type scopeT struct {
+	// key is the map key or index of the item being selected.
+	// It's invalid outside of a select.
+	key reflect.Value
 }
 
 // ------------------------------------------------------------
 // ARRAY-NODE
 
 // arrayNode performs an array indexing. Currently it supports
-// a single int index.
+// a single int index; negative indexes count back from the end.
+// On a map, the index is a key.
 type arrayNode struct {
 	Lhs   AstNode // Optional -- if missing then I just use my input directly
 	Index int
 }
 
-func (n *arrayNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *arrayNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	// fmt.Println("Eval arrayNode", n.Lhs, n.Index)
 
 	lhs := _i
 	if n.Lhs != nil {
 		var err error
-		lhs, err = n.Lhs.Eval(_i, opt)
+		lhs, err = n.Lhs.Eval(_i, opt, scope)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// We need to decide on how to handle invalid node input:
-	// I'm currently inclined to just returned no result, since this
-	// is a search.
-	if lhs == nil {
-		return nil, nil
-	}
-
 	// We need to distinguish between slices, arrays, and single items
-	rt := reflect.TypeOf(lhs)
-	switch rt.Kind() {
+	src := indirectValue(reflect.ValueOf(lhs))
+	switch src.Kind() {
+	case reflect.Invalid:
+		return nilResult("operator []", opt)
+	case reflect.Map:
+		// Maps are indexed by key, i.e. map[int]T.
+		if key, ok := mapKey(src, strconv.Itoa(n.Index)); ok {
+			return valueInterface(src.MapIndex(key)), nil
+		}
+		return nil, nil
 	case reflect.Array, reflect.Slice:
-		src := reflect.Indirect(reflect.ValueOf(lhs))
 		// This matches what I expect of a single-index array access
 		// (that it returns a single requested value)
 		if src.Len() < 1 {
 			return nil, nil
 		}
-		if n.Index >= 0 && n.Index < src.Len() {
-			item := src.Index(n.Index)
-			return item.Interface(), nil
+		index := n.Index
+		if index < 0 {
+			index += src.Len()
+		}
+		if index >= 0 && index < src.Len() {
+			return valueInterface(src.Index(index)), nil
 		}
 	}
 
@@ -71,38 +88,47 @@ func (n *arrayNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
 // ------------------------------------------------------------
 // BINARY-NODE
 
-// binaryNode performs binary operations on the current interface{}.
+// binaryNode performs binary operations on the current interface{}:
+// comparisons, conditionals and arithmetic.
 type binaryNode struct {
 	Op  symbol
 	Lhs AstNode
 	Rhs AstNode
 }
 
-func (n *binaryNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *binaryNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	// fmt.Println("Eval binaryNode", n.Lhs, n.Rhs)
 	if n.Lhs == nil || n.Rhs == nil {
 		return nil, newMalformedError("binary node")
 	}
 	switch n.Op {
 	case eqlToken:
-		return n.evalEql(_i, opt)
+		return n.evalEql(_i, opt, scope)
 	case neqToken:
-		resp, err := n.evalEql(_i, opt)
+		resp, err := n.evalEql(_i, opt, scope)
 		if err != nil {
 			return false, err
 		}
 		return !resp, err
+	case ltToken, lteToken, gtToken, gteToken:
+		return n.evalCompare(_i, opt, scope)
+	case containsToken, startsWithToken, endsWithToken, matchToken:
+		return n.evalMatch(_i, opt, scope)
+	case inToken:
+		return n.evalIn(_i, opt, scope)
 	case andToken:
-		return n.evalAnd(_i, opt)
+		return n.evalAnd(_i, opt, scope)
 	case orToken:
-		return n.evalOr(_i, opt)
+		return n.evalOr(_i, opt, scope)
+	case addToken, negToken, starToken, divToken, modToken:
+		return n.evalArithmetic(_i, opt, scope)
 	default:
 		return nil, newUnhandledError("binary " + strconv.Itoa(int(n.Op)))
 	}
 }
 
-func (n *binaryNode) evalEql(_i interface{}, opt *Opt) (bool, error) {
-	lhs, rhs, err := n.evalBinary(_i, opt)
+func (n *binaryNode) evalEql(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
 	if err != nil {
 		return false, err
 	}
@@ -117,8 +143,52 @@ func (n *binaryNode) evalEql(_i interface{}, opt *Opt) (bool, error) {
 	return eq, nil
 }
 
-func (n *binaryNode) evalAnd(_i interface{}, opt *Opt) (bool, error) {
-	lhs, rhs, err := n.evalBinary(_i, opt)
+func (n *binaryNode) evalCompare(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
+	if err != nil {
+		return false, err
+	}
+	strict := false
+	if opt != nil {
+		strict = opt.Strict
+	}
+	cmp, err := interfacesCompare(lhs, rhs, strict)
+	if err != nil {
+		if strict {
+			return false, err
+		}
+		return false, nil
+	}
+	switch n.Op {
+	case ltToken:
+		return cmp < 0, nil
+	case lteToken:
+		return cmp <= 0, nil
+	case gtToken:
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func (n *binaryNode) evalMatch(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
+	if err != nil {
+		return false, err
+	}
+	return interfacesMatch(n.Op, lhs, rhs, opt != nil && opt.Strict)
+}
+
+func (n *binaryNode) evalIn(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
+	if err != nil {
+		return false, err
+	}
+	return interfacesIn(lhs, rhs, opt != nil && opt.Strict)
+}
+
+func (n *binaryNode) evalAnd(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
 	if err != nil {
 		return false, err
 	}
@@ -130,8 +200,8 @@ func (n *binaryNode) evalAnd(_i interface{}, opt *Opt) (bool, error) {
 	return ls && rs, nil
 }
 
-func (n *binaryNode) evalOr(_i interface{}, opt *Opt) (bool, error) {
-	lhs, rhs, err := n.evalBinary(_i, opt)
+func (n *binaryNode) evalOr(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
 	if err != nil {
 		return false, err
 	}
@@ -143,16 +213,65 @@ func (n *binaryNode) evalOr(_i interface{}, opt *Opt) (bool, error) {
 	return ls || rs, nil
 }
 
-func (n *binaryNode) evalBinary(_i interface{}, opt *Opt) (interface{}, interface{}, error) {
-	lhs, err := n.Lhs.Eval(_i, opt)
+func (n *binaryNode) evalArithmetic(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	lhs, rhs, err := n.evalBinary(_i, opt, scope)
+	if err != nil {
+		return nil, err
+	}
+	return arithmetic(n.Op, lhs, rhs, opt != nil && opt.Strict)
+}
+
+// evalBinary() answers the results of my sides, with pointers
+// to values followed to the values they point to.
+func (n *binaryNode) evalBinary(_i interface{}, opt *Opt, scope scopeT) (interface{}, interface{}, error) {
+	lhs, err := n.Lhs.Eval(_i, opt, scope)
 	if err != nil {
 		return nil, nil, err
 	}
-	rhs, err := n.Rhs.Eval(_i, opt)
+	rhs, err := n.Rhs.Eval(_i, opt, scope)
 	if err != nil {
 		return nil, nil, err
 	}
-	return lhs, rhs, nil
+	return indirectInterface(lhs), indirectInterface(rhs), nil
+}
+
+// ------------------------------------------------------------
+// CALL-NODE
+
+// callNode calls a function with the results of its args.
+type callNode struct {
+	Fn   *funcT
+	Args []AstNode
+}
+
+func (n *callNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval callNode", n.Fn, n.Args)
+	if n.Fn == nil {
+		return nil, newMalformedError("call node")
+	}
+	strict := false
+	if opt != nil {
+		strict = opt.Strict
+	}
+	args := make([]reflect.Value, 0, len(n.Args))
+	for i, arg := range n.Args {
+		param := n.Fn.param(i)
+		// Expr params are handed the arg itself to evaluate.
+		if param == exprType {
+			args = append(args, reflect.ValueOf(&boundExprT{ast: arg, opt: opt, scope: scope}))
+			continue
+		}
+		v, err := arg.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		av, err := assignableValue(v, param, strict)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, av)
+	}
+	return n.Fn.call(args)
 }
 
 // ------------------------------------------------------------
@@ -163,83 +282,493 @@ type constantNode struct {
 	Value interface{}
 }
 
-func (n *constantNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *constantNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	//	fmt.Println("Evak constantNode", n.Value)
-	return n.Value, nil
+	// Expressions are shared, so a list is copied in case the caller changes it.
+	return copyList(n.Value), nil
+}
+
+// copyList() answers a copy of v if it's a list, including any lists in it.
+func copyList(v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	ans := make([]interface{}, len(list))
+	for i, item := range list {
+		ans[i] = copyList(item)
+	}
+	return ans
+}
+
+// ------------------------------------------------------------
+// DESCEND-NODE
+
+// descendNode finds a field at any depth of the current interface{}.
+// All matches are answered in a slice, in the order they're found.
+type descendNode struct {
+	Child AstNode // Optional -- if missing then I just use my input directly
+	Field string
+	Any   bool // Match every field, not just Field
+}
+
+func (n *descendNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval descendNode", n.Child, n.Field)
+	if len(n.Field) < 1 && !n.Any {
+		return nil, newMalformedError("descend node")
+	}
+	if n.Child != nil {
+		var err error
+		_i, err = n.Child.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !indirectValue(reflect.ValueOf(_i)).IsValid() {
+		return nilResult("operator //", opt)
+	}
+	var found []interface{}
+	n.walk(reflect.ValueOf(_i), opt, make(map[visitKey]bool), &found)
+	return gather(found), nil
+}
+
+// walk() collects matches from v and everything below it. References
+// are tracked while they're being walked to guard against cycles.
+func (n *descendNode) walk(v reflect.Value, opt *Opt, visited map[visitKey]bool, found *[]interface{}) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Ptr {
+			if !visit(v, visited) {
+				return
+			}
+			defer unvisit(v, visited)
+		}
+		v = v.Elem()
+	}
+	// Matches at this level are collected before descending, so
+	// shallower results come first.
+	var children []reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		rt := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := rt.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if name, _ := tagName(field, opt.Tag); n.Any || name == n.Field {
+				n.collect(v.Field(i), found)
+			}
+			children = append(children, v.Field(i))
+		}
+	case reflect.Map:
+		if !visit(v, visited) {
+			return
+		}
+		defer unvisit(v, visited)
+		want, ok := mapKey(v, n.Field)
+		for _, key := range sortedMapKeys(v) {
+			item := v.MapIndex(key)
+			if n.Any || (ok && valueInterface(key) == valueInterface(want)) {
+				n.collect(item, found)
+			}
+			children = append(children, item)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if !visit(v, visited) {
+				return
+			}
+			defer unvisit(v, visited)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if n.Any {
+				n.collect(v.Index(i), found)
+			}
+			children = append(children, v.Index(i))
+		}
+	}
+	for _, child := range children {
+		n.walk(child, opt, visited, found)
+	}
+}
+
+func (n *descendNode) collect(v reflect.Value, found *[]interface{}) {
+	if i := valueInterface(v); i != nil {
+		*found = append(*found, i)
+	}
+}
+
+// ------------------------------------------------------------
+// EACH-NODE
+
+// eachNode evaluates its child on every item of an array or slice,
+// answering the results in a slice. Any other input is evaluated directly.
+type eachNode struct {
+	Child AstNode
+}
+
+func (n *eachNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval eachNode", n.Child)
+	if n.Child == nil {
+		return nil, newMalformedError("each node")
+	}
+	v := indirectValue(reflect.ValueOf(_i))
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := n.Child.Eval(valueInterface(v.Index(i)), opt, scope)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return gather(items), nil
+	default:
+		return n.Child.Eval(_i, opt, scope)
+	}
 }
 
 // ------------------------------------------------------------
 // FIELD-NODE
 
 // fieldNode is used to select a field from the current interface{}.
+// On an array or slice, it selects the field from every item.
 type fieldNode struct {
 	Field string
+	// plan is the last field plan I used. Collections are usually all
+	// one type, so it saves looking the plan up for every item. Plans
+	// are made when a type is first evaluated, not when I'm compiled:
+	// expressions are untyped, and one can run on any input, so the
+	// types aren't known until then.
+	plan atomic.Pointer[fieldPlanT]
 }
 
-func (n *fieldNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *fieldNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	// fmt.Println("Eval fieldNode", n.Field)
 	if len(n.Field) < 1 {
 		return nil, newMalformedError("field node")
 	}
-	if _i == nil {
-		return nil, nil
+	// The common case for hydrated json.
+	if t, ok := _i.(map[string]interface{}); ok && t != nil {
+		child, ok := t[n.Field]
+		if ok || !opt.IgnoreCase {
+			return child, nil
+		}
+		return n.foldMapIndex(reflect.ValueOf(t), opt)
+	}
+	if _, ok := _i.(reflect.Value); ok {
+		return nil, newConditionError("fieldNode must not receive reflect.Value")
 	}
-	// Collectinons with special handling.
-	rt := reflect.TypeOf(_i)
-	ismap := false
-	switch rt.Kind() {
-	case reflect.Array:
-		return nil, newConditionError("fieldNode must not receive reflect.Array")
-	case reflect.Slice:
-		return nil, newConditionError("fieldNode must not receive reflect.Slice")
+
+	v := indirectValue(reflect.ValueOf(_i))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nilResult("/"+n.Field, opt)
+	case reflect.Array, reflect.Slice:
+		return n.project(v, opt, scope)
 	case reflect.Map:
-		ismap = true
+		if key, ok := mapKey(v, n.Field); ok {
+			if found := v.MapIndex(key); found.IsValid() {
+				return valueInterface(found), nil
+			}
+		}
+		if opt.IgnoreCase {
+			return n.foldMapIndex(v, opt)
+		}
+		return nil, nil
+	default:
+		return n.runOnValue(v, opt)
 	}
+}
 
-	var child interface{}
-	var err error
-	switch t := _i.(type) {
-	case map[string]interface{}:
-		child = t[n.Field]
-	case reflect.Value:
-		return nil, newConditionError("fieldNode must not receive reflect.Value")
+// project() answers my field from every item of a collection, flattening
+// any collections that result. Missing values are skipped, as are nil
+// items unless opt is strict.
+func (n *fieldNode) project(v reflect.Value, opt *Opt, scope scopeT) (interface{}, error) {
+	items := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := valueInterface(v.Index(i))
+		if isNil(item) {
+			if _, err := nilResult("/"+n.Field, opt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		child, err := n.Eval(item, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		cv := indirectValue(reflect.ValueOf(child))
+		switch cv.Kind() {
+		case reflect.Invalid:
+		case reflect.Array, reflect.Slice:
+			for j := 0; j < cv.Len(); j++ {
+				items = append(items, valueInterface(cv.Index(j)))
+			}
+		default:
+			items = append(items, child)
+		}
+	}
+	return gather(items), nil
+}
+
+// foldMapIndex() answers the value in map m whose key differs
+// from my field only by case.
+func (n *fieldNode) foldMapIndex(m reflect.Value, opt *Opt) (interface{}, error) {
+	key, err := findMapKey(m, n.Field, opt)
+	if err != nil || !key.IsValid() {
+		return nil, err
+	}
+	return valueInterface(m.MapIndex(key)), nil
+}
+
+// runOnValue() answers my field of v, or else the result of my
+// getter method.
+func (n *fieldNode) runOnValue(v reflect.Value, opt *Opt) (interface{}, error) {
+	if v.Kind() == reflect.Struct {
+		plan := n.plan.Load()
+		if plan == nil || !plan.matches(v.Type(), opt) {
+			plan = fieldPlanFor(v.Type(), n.Field, opt)
+			n.plan.Store(plan)
+		}
+		index, err := plan.resolve(n.Field, opt)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			return valueInterface(fieldValue(v, index)), nil
+		}
+	}
+	if !opt.Methods {
+		return nil, newEvalError("no field " + n.Field + " in " + v.Type().String())
+	}
+	if m := findMethod(v, n.Field); m.IsValid() {
+		ans, err := callGetter(m, n.Field)
+		if err != nil {
+			return nil, err
+		}
+		return valueInterface(ans), nil
+	}
+	return nil, newEvalError("no field " + n.Field + " in " + v.Type().String())
+}
+
+// ------------------------------------------------------------
+// LIMIT-NODE
+
+// limitNode answers at most Count items of an array or slice, after
+// skipping Offset items, as a new slice of the same element type.
+type limitNode struct {
+	Lhs    AstNode
+	Count  AstNode // Optional -- if missing then there's no limit
+	Offset AstNode // Optional -- if missing then nothing is skipped
+}
+
+func (n *limitNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval limitNode", n.Lhs, n.Count, n.Offset)
+	if n.Lhs == nil {
+		return nil, newMalformedError("limit node")
+	}
+	lhs, err := n.Lhs.Eval(_i, opt, scope)
+	if err != nil {
+		return nil, err
+	}
+	v := indirectValue(reflect.ValueOf(lhs))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nilResult("limit", opt)
+	case reflect.Array, reflect.Slice:
 	default:
-		// Special condition, this is a specific type of map, but we don't
-		// know what kind.
-		if ismap {
-			key := reflect.ValueOf(n.Field)
-			child = reflect.Indirect(reflect.ValueOf(_i)).MapIndex(key)
-		} else {
-			child, err = n.runOnValue(reflect.Indirect(reflect.ValueOf(_i)))
+		if opt.Strict {
+			return nil, newEvalError("limit must have array or slice")
 		}
+		return lhs, nil
+	}
+	start, err := n.evalCount(n.Offset, _i, opt, scope, 0)
+	if err != nil {
+		return nil, err
 	}
-	if child == nil || err != nil {
+	count, err := n.evalCount(n.Count, _i, opt, scope, v.Len())
+	if err != nil {
 		return nil, err
 	}
-	return n.getInterface(child)
+	if start > v.Len() {
+		start = v.Len()
+	}
+	end := v.Len()
+	if count < end-start {
+		end = start + count
+	}
+	dst := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, end-start)
+	for i := start; i < end; i++ {
+		dst = reflect.Append(dst, v.Index(i))
+	}
+	return dst.Interface(), nil
 }
 
-func (n *fieldNode) runOnValue(v reflect.Value) (interface{}, error) {
-	f := v.FieldByName(n.Field)
-	if f.IsValid() {
-		return f, nil
+// evalCount() answers the value of a count or offset, which must be
+// a whole number that isn't negative.
+func (n *limitNode) evalCount(node AstNode, _i interface{}, opt *Opt, scope scopeT, def int) (int, error) {
+	if node == nil {
+		return def, nil
 	}
-	return nil, errors.New("No field for " + n.Field)
+	v, err := node.Eval(_i, opt, scope)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := toFloat64(v)
+	if !ok || f < 0 || f != float64(int(f)) {
+		return 0, newEvalError("limit and offset must be whole numbers, not " + fmt.Sprint(v))
+	}
+	return int(f), nil
+}
+
+// ------------------------------------------------------------
+// LIST-NODE
+
+// listNode answers a list literal whose items must be evaluated.
+type listNode struct {
+	Items []AstNode
+}
+
+func (n *listNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval listNode", n.Items)
+	ans := make([]interface{}, 0, len(n.Items))
+	for _, item := range n.Items {
+		v, err := item.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		ans = append(ans, v)
+	}
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// OBJECT-NODE
+
+// objectNode builds a map from the results of evaluating each value.
+type objectNode struct {
+	Keys   []string
+	Values []AstNode
+}
+
+func (n *objectNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval objectNode", n.Keys)
+	if len(n.Keys) != len(n.Values) {
+		return nil, newMalformedError("object node")
+	}
+	ans := make(map[string]interface{}, len(n.Keys))
+	for i, key := range n.Keys {
+		v, err := n.Values[i].Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		ans[key] = v
+	}
+	return ans, nil
+}
+
+// ------------------------------------------------------------
+// ORDER-NODE
+
+// orderNode sorts an array or slice by the result of evaluating each
+// key on every item, answering a new slice of the same element type.
+// The sort is stable, and nil values are ordered first.
+type orderNode struct {
+	Lhs  AstNode
+	Keys []AstNode
+	Desc []bool
+}
+
+func (n *orderNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval orderNode", n.Lhs, n.Keys)
+	if n.Lhs == nil || len(n.Keys) != len(n.Desc) {
+		return nil, newMalformedError("order node")
+	}
+	lhs, err := n.Lhs.Eval(_i, opt, scope)
+	if err != nil {
+		return nil, err
+	}
+	v := indirectValue(reflect.ValueOf(lhs))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nilResult("orderBy", opt)
+	case reflect.Array, reflect.Slice:
+	default:
+		if opt.Strict {
+			return nil, newEvalError("orderBy must have array or slice")
+		}
+		return lhs, nil
+	}
+
+	// Evaluate every key once, then sort the item indexes.
+	keys := make([][]interface{}, v.Len())
+	indexes := make([]int, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := valueInterface(v.Index(i))
+		keys[i] = make([]interface{}, len(n.Keys))
+		for k, key := range n.Keys {
+			keys[i][k], err = key.Eval(item, opt, scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		for k := range n.Keys {
+			cmp, cerr := orderCompare(keys[indexes[a]][k], keys[indexes[b]][k], opt.Strict)
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+			if n.Desc[k] {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dst := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, v.Len())
+	for _, i := range indexes {
+		dst = reflect.Append(dst, v.Index(i))
+	}
+	return dst.Interface(), nil
+}
+
+// ------------------------------------------------------------
+// PARAM-NODE
+
+// paramNode answers a value supplied in the options, either
+// by name (Opt.Params) or by position (Opt.Args).
+type paramNode struct {
+	Name  string // Optional -- if missing then I use Index
+	Index int
 }
 
-// getInterface() calls reflect.Value.Interface() "safely" by handling
-// the panic. The reflect package doesn't seem to define any way to
-// determine if caling Interface() is valid, and as far as I can see,
-// rolling your own is fairly heavyweight.
-func (n *fieldNode) getInterface(_i interface{}) (interface{}, error) {
-	defer func() {
-		if r := recover(); r != nil {
+func (n *paramNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval paramNode", n.Name, n.Index)
+	if n.Name != "" {
+		if opt != nil {
+			if v, ok := opt.Params[n.Name]; ok {
+				return v, nil
+			}
 		}
-	}()
-	if i, ok := _i.(reflect.Value); ok {
-		return i.Interface(), nil
+		return nil, newEvalError("missing param $" + n.Name)
+	}
+	if opt == nil || n.Index < 0 || n.Index >= len(opt.Args) {
+		return nil, newEvalError("missing param ? at " + strconv.Itoa(n.Index))
 	}
-	return _i, nil
+	return opt.Args[n.Index], nil
 }
 
 // ------------------------------------------------------------
@@ -251,19 +780,42 @@ type pathNode struct {
 	Field AstNode `json:"field,omitempty"`
 }
 
-func (n *pathNode) Eval(i interface{}, opt *Opt) (interface{}, error) {
+func (n *pathNode) Eval(i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	// fmt.Println("Eval pathNode", n.Child, n.Field)
 	if n.Field == nil {
 		return nil, newMalformedError("path node")
 	}
 	if n.Child != nil {
 		var err error
-		i, err = n.Child.Eval(i, opt)
+		i, err = n.Child.Eval(i, opt, scope)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return n.Field.Eval(i, opt)
+	return n.Field.Eval(i, opt, scope)
+}
+
+// ------------------------------------------------------------
+// SCOPE-NODE
+
+// scopeNode answers a pseudo-field of the item being selected: the
+// item itself for @value, or its map key or index for @key.
+type scopeNode struct {
+	Key bool
+}
+
+func (n *scopeNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval scopeNode", n.Key)
+	if !n.Key {
+		return _i, nil
+	}
+	if !scope.key.IsValid() {
+		if opt.Strict {
+			return nil, newEvalError("@key must be in a select")
+		}
+		return nil, nil
+	}
+	return scope.key.Interface(), nil
 }
 
 // ------------------------------------------------------------
@@ -271,25 +823,25 @@ func (n *pathNode) Eval(i interface{}, opt *Opt) (interface{}, error) {
 
 // selectnNode is a select statement: It expects a collection
 // of items, and a child that will resolve each item to
-// true or false. It answers the result of all true evaluations.
+// true or false. It answers the result of all true evaluations,
+// in a slice for arrays and slices, or a map of the same type for maps.
 type selectNode struct {
 	Child AstNode
 }
 
-func (n *selectNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *selectNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	// fmt.Println("Eval selectNode", n.Child)
 	if n.Child == nil {
 		return nil, newMalformedError("select node")
 	}
-	rt := reflect.TypeOf(_i)
-	switch rt.Kind() {
+	// Each item is evaluated with its key in scope.
+	src := indirectValue(reflect.ValueOf(_i))
+	switch src.Kind() {
 	case reflect.Array, reflect.Slice:
-		src := reflect.Indirect(reflect.ValueOf(_i))
-		collectiontype := rt.Elem()
-		dst := reflect.MakeSlice(reflect.SliceOf(collectiontype), 0, src.Len())
+		dst := reflect.MakeSlice(reflect.SliceOf(src.Type().Elem()), 0, src.Len())
 		for i := 0; i < src.Len(); i++ {
 			item := src.Index(i)
-			b, err := n.isTrue(item.Interface(), opt)
+			b, err := n.isTrue(valueInterface(item), opt, scopeT{key: reflect.ValueOf(i)})
 			if err != nil {
 				return nil, err
 			}
@@ -298,6 +850,21 @@ func (n *selectNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
 			}
 		}
 		return dst.Interface(), nil
+	case reflect.Map:
+		dst := reflect.MakeMap(src.Type())
+		for _, key := range sortedMapKeys(src) {
+			item := src.MapIndex(key)
+			b, err := n.isTrue(valueInterface(item), opt, scopeT{key: key})
+			if err != nil {
+				return nil, err
+			}
+			if b {
+				dst.SetMapIndex(key, item)
+			}
+		}
+		return dst.Interface(), nil
+	case reflect.Invalid:
+		return nilResult("select", opt)
 	default:
 		// It's an open question what to do when operating selects on
 		// non-collections. I'm inclined to think of this as a search,
@@ -308,8 +875,8 @@ func (n *selectNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
 }
 
 // isTrue() determines if my child evaluates to true based on the input.
-func (n *selectNode) isTrue(_i interface{}, opt *Opt) (bool, error) {
-	resp, err := n.Child.Eval(_i, opt)
+func (n *selectNode) isTrue(_i interface{}, opt *Opt, scope scopeT) (bool, error) {
+	resp, err := n.Child.Eval(_i, opt, scope)
 	if err != nil {
 		return false, err
 	}
@@ -319,6 +886,83 @@ func (n *selectNode) isTrue(_i interface{}, opt *Opt) (bool, error) {
 	return false, newEvalError("must result ine boolean")
 }
 
+// ------------------------------------------------------------
+// SLICE-NODE
+
+// sliceNode answers a range of an array or slice as a new slice of
+// the same element type. Negative bounds count back from the end,
+// missing bounds cover the rest of the collection, and a negative
+// step walks the collection in reverse.
+type sliceNode struct {
+	Lhs   AstNode // Optional -- if missing then I just use my input directly
+	Start *int    // Optional
+	End   *int    // Optional
+	Step  int     // Must not be zero
+}
+
+func (n *sliceNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval sliceNode", n.Lhs, n.Start, n.End, n.Step)
+	if n.Step == 0 {
+		return nil, newMalformedError("slice node")
+	}
+
+	lhs := _i
+	if n.Lhs != nil {
+		var err error
+		lhs, err = n.Lhs.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	src := indirectValue(reflect.ValueOf(lhs))
+	switch src.Kind() {
+	case reflect.Invalid:
+		return nilResult("operator [:]", opt)
+	case reflect.Array, reflect.Slice:
+		start, end := n.bounds(src.Len())
+		dst := reflect.MakeSlice(reflect.SliceOf(src.Type().Elem()), 0, 0)
+		for i := start; (n.Step > 0 && i < end) || (n.Step < 0 && i > end); i += n.Step {
+			dst = reflect.Append(dst, src.Index(i))
+		}
+		return dst.Interface(), nil
+	}
+
+	// When not in strict mode, invalid arrays are pass-throughs.
+	if opt != nil && opt.Strict {
+		return nil, newEvalError("operator [:] must have array or slice")
+	}
+	return lhs, nil
+}
+
+// bounds() answers the first index and the (exclusive) last
+// index for a collection of the given length.
+func (n *sliceNode) bounds(length int) (int, int) {
+	// The lowest and highest valid values, which depend on direction.
+	lo, hi := 0, length
+	if n.Step < 0 {
+		lo, hi = -1, length-1
+	}
+	clamp := func(i *int, def int) int {
+		if i == nil {
+			return def
+		}
+		v := *i
+		if v < 0 {
+			v += length
+		}
+		if v < lo {
+			return lo
+		} else if v > hi {
+			return hi
+		}
+		return v
+	}
+	if n.Step < 0 {
+		return clamp(n.Start, hi), clamp(n.End, lo)
+	}
+	return clamp(n.Start, lo), clamp(n.End, hi)
+}
+
 // ------------------------------------------------------------
 // UNARY-NODE
 
@@ -328,17 +972,199 @@ type unaryNode struct {
 	Child AstNode
 }
 
-func (n *unaryNode) Eval(_i interface{}, opt *Opt) (interface{}, error) {
+func (n *unaryNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
 	//	fmt.Println("Eval unaryNode", n.Child)
 	if n.Child == nil {
 		return nil, newMalformedError("unary node")
 	}
-	return n.Child.Eval(_i, opt)
+	switch n.Op {
+	case negToken:
+		v, err := n.Child.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		return negate(indirectInterface(v), opt != nil && opt.Strict)
+	case notToken:
+		v, err := n.Child.Eval(_i, opt, scope)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := indirectInterface(v).(bool)
+		if !ok {
+			return false, newConditionError("! must evaluate to boolean")
+		}
+		return !b, nil
+	default:
+		return n.Child.Eval(_i, opt, scope)
+	}
+}
+
+// ------------------------------------------------------------
+// WILDCARD-NODE
+
+// wildcardNode answers every value in the current interface{}: the
+// fields of a struct, the values of a map (ordered by key), or the
+// items of an array or slice.
+type wildcardNode struct {
+}
+
+func (n *wildcardNode) Eval(_i interface{}, opt *Opt, scope scopeT) (interface{}, error) {
+	// fmt.Println("Eval wildcardNode")
+	v := indirectValue(reflect.ValueOf(_i))
+	var found []interface{}
+	add := func(item reflect.Value) {
+		if i := valueInterface(item); i != nil {
+			found = append(found, i)
+		}
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		rt := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if rt.Field(i).PkgPath == "" {
+				add(v.Field(i))
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedMapKeys(v) {
+			add(v.MapIndex(key))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			add(v.Index(i))
+		}
+	case reflect.Invalid:
+		return nilResult("operator *", opt)
+	default:
+		if opt != nil && opt.Strict {
+			return nil, newEvalError("operator * must have struct, map, array or slice")
+		}
+		return nil, nil
+	}
+	return gather(found), nil
 }
 
 // ----------------------------------------
 // MISC
 
+// gather() answers the items as a slice. If every item is the same
+// type then the slice is that type, otherwise it is []interface{}.
+func gather(items []interface{}) interface{} {
+	var rt reflect.Type
+	for i, item := range items {
+		if i == 0 {
+			rt = reflect.TypeOf(item)
+		} else if rt != reflect.TypeOf(item) {
+			return items
+		}
+	}
+	if rt == nil {
+		// Empty, or every item is nil
+		return append([]interface{}{}, items...)
+	}
+	dst := reflect.MakeSlice(reflect.SliceOf(rt), 0, len(items))
+	for _, item := range items {
+		dst = reflect.Append(dst, reflect.ValueOf(item))
+	}
+	return dst.Interface()
+}
+
+// indirectValue() follows pointers and interfaces to the underlying value.
+// The result is invalid if any were nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirectInterface() answers the value i points to, if it's a pointer
+// to anything other than a struct. A nil pointer answers nil.
+func indirectInterface(i interface{}) interface{} {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr {
+		return i
+	}
+	if v.IsNil() {
+		return nil
+	}
+	if v.Type().Elem().Kind() == reflect.Struct {
+		return i
+	}
+	return valueInterface(indirectValue(v))
+}
+
+// isNil() answers true if i is nil, or a nil pointer, map, slice or interface.
+func isNil(i interface{}) bool {
+	if i == nil {
+		return true
+	}
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// nilResult() answers the result of applying an operator to nil,
+// which is nil, or an error if opt is strict.
+func nilResult(op string, opt *Opt) (interface{}, error) {
+	if opt != nil && opt.Strict {
+		return nil, newEvalError(op + " on nil")
+	}
+	return nil, nil
+}
+
+// valueInterface() answers the value as an interface{}, or nil if
+// it's invalid, empty or unexported.
+func valueInterface(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// sortedMapKeys() answers the keys of a map value in a stable order.
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(a, b int) bool {
+		ka, kb := keys[a], keys[b]
+		if ka.Kind() == reflect.String && kb.Kind() == reflect.String {
+			return ka.String() < kb.String()
+		}
+		if cmp, err := interfacesCompare(valueInterface(ka), valueInterface(kb), false); err == nil {
+			return cmp < 0
+		}
+		return fmt.Sprint(valueInterface(ka)) < fmt.Sprint(valueInterface(kb))
+	})
+	return keys
+}
+
+// visitKey identifies a pointer, map or slice that is being visited.
+type visitKey struct {
+	rt  reflect.Type
+	ptr uintptr
+}
+
+// visit() marks the reference value v as being visited, answering
+// false if it already is.
+func visit(v reflect.Value, visited map[visitKey]bool) bool {
+	key := visitKey{v.Type(), v.Pointer()}
+	if visited[key] {
+		return false
+	}
+	visited[key] = true
+	return true
+}
+
+func unvisit(v reflect.Value, visited map[visitKey]bool) {
+	delete(visited, visitKey{v.Type(), v.Pointer()})
+}
+
 // clone() is a clever way to copy a slice, but I don't think I need or want it.
 func clone(i interface{}) interface{} {
 	// Wrap argument to reflect.Value, dereference it and return back as interface{}
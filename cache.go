@@ -0,0 +1,136 @@
+package sqi
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// ------------------------------------------------------------
+// CACHE
+
+// Cache holds compiled expressions so that evaluating the same term again
+// doesn't repeat the work of making it. When it's full, the least recently
+// used expression is dropped. A Cache is safe for concurrent use.
+//
+// The Eval() functions share a default cache, which can be replaced or
+// disabled with SetCache().
+type Cache struct {
+	mutex sync.Mutex
+	size  int
+	items map[cacheKey]*list.Element
+	order *list.List // Most recently used first
+}
+
+// NewCache answers a new cache that holds at most size expressions.
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{size: size, items: make(map[cacheKey]*list.Element), order: list.New()}
+}
+
+// MakeExpr answers the compiled expression for term, making it with
+// MakeExprOpt() if it isn't in the cache. Errors aren't cached.
+func (c *Cache) MakeExpr(term string, opt *Opt) (Expr, error) {
+	key := newCacheKey(term, opt)
+	c.mutex.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mutex.Unlock()
+		return elem.Value.(*cacheEntry).expr, nil
+	}
+	c.mutex.Unlock()
+
+	expr, err := MakeExprOpt(term, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Another caller might have made it in the meantime.
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cacheEntry).expr, nil
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, expr: expr})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+	return expr, nil
+}
+
+// Len answers the number of expressions in the cache.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Clear removes every expression from the cache.
+func (c *Cache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items = make(map[cacheKey]*list.Element)
+	c.order.Init()
+}
+
+// SetCache sets the cache used by the Eval() functions. A nil cache
+// disables caching, so every term is made again each time.
+func SetCache(c *Cache) {
+	defaultCache.Store(c)
+}
+
+// makeExpr answers the expression for term, from the default cache if there is one.
+func makeExpr(term string, opt *Opt) (Expr, error) {
+	if c := defaultCache.Load(); c != nil {
+		return c.MakeExpr(term, opt)
+	}
+	return MakeExprOpt(term, opt)
+}
+
+// ------------------------------------------------------------
+// CACHE-KEY
+
+// cacheKey identifies a compiled expression. Functions are resolved when
+// an expression is made, so the key includes the function collections, and
+// their generations so that adding a function replaces stale expressions.
+type cacheKey struct {
+	term       string
+	funcs      *Funcs
+	funcsGen   uint64
+	globalsGen uint64
+}
+
+func newCacheKey(term string, opt *Opt) cacheKey {
+	key := cacheKey{term: term, globalsGen: globalFuncs.generation()}
+	if opt != nil && opt.Funcs != nil {
+		key.funcs = opt.Funcs
+		key.funcsGen = opt.Funcs.generation()
+	}
+	return key
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	expr Expr
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+const (
+	// DefaultCacheSize is the size of the cache used by the Eval() functions.
+	DefaultCacheSize = 256
+)
+
+var (
+	defaultCache atomic.Pointer[Cache]
+)
+
+func init() {
+	defaultCache.Store(NewCache(DefaultCacheSize))
+}
@@ -3,11 +3,14 @@ package sqi
 import (
 	"math"
 	"reflect"
+	"regexp"
+	"strings"
 )
 
 // interfacesEqual() answers true if both interfaces are the same underlying data.
-// If strict is true, numbers must be of the same type. If it's false,
-// numbers will attempt to convert for a comparison.
+// Numbers can be any int, uint or float kind. If strict is true, numbers must
+// be of the same type. If it's false, numbers will attempt to convert for a
+// comparison.
 func interfacesEqual(a, b interface{}, strict bool) (bool, error) {
 	if a == nil && b == nil {
 		return true, nil
@@ -25,49 +28,212 @@ func interfacesEqual(a, b interface{}, strict bool) (bool, error) {
 			return at == bt, nil
 		}
 		return false, newMismatchError("types " + reflect.TypeOf(a).Name() + " and " + reflect.TypeOf(b).Name())
-	case int:
-		if bt, ok := b.(int); ok {
-			return at == bt, nil
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !isNumberKind(av.Kind()) {
+		return false, newUnhandledError("type " + av.Type().Name())
+	}
+	if !isNumberKind(bv.Kind()) && !strict {
+		return false, newUnhandledError("type " + bv.Type().Name())
+	}
+	if !isNumberKind(bv.Kind()) || (strict && av.Type() != bv.Type()) {
+		return false, newMismatchError("types " + av.Type().Name() + " and " + bv.Type().Name())
+	}
+	return numbersCompare(av, bv) == 0, nil
+}
+
+// interfacesCompare() answers -1 if a is less than b, 0 if they are equal,
+// and 1 if a is greater than b. Only numbers and strings are ordered; strict
+// behaves the same as in interfacesEqual().
+func interfacesCompare(a, b interface{}, strict bool) (int, error) {
+	if a == nil || b == nil {
+		return 0, newMismatchError("can't order nil")
+	}
+	switch at := a.(type) {
+	case string:
+		if bt, ok := b.(string); ok {
+			return strings.Compare(at, bt), nil
 		}
-		if !strict {
-			return numbersEqual(float64(at), b)
+		return 0, newMismatchError("types " + reflect.TypeOf(a).Name() + " and " + reflect.TypeOf(b).Name())
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !isNumberKind(av.Kind()) {
+		return 0, newUnhandledError("type " + av.Type().Name())
+	}
+	if !isNumberKind(bv.Kind()) || (strict && av.Type() != bv.Type()) {
+		return 0, newMismatchError("types " + av.Type().Name() + " and " + bv.Type().Name())
+	}
+	return numbersCompare(av, bv), nil
+}
+
+// orderCompare() orders two values for sorting. Unlike interfacesCompare(),
+// nil is ordered before everything else, and unless strict is true,
+// values that can't be compared are treated as equal.
+func orderCompare(a, b interface{}, strict bool) (int, error) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, nil
+		} else if a == nil {
+			return -1, nil
 		}
-		return false, newMismatchError("types " + reflect.TypeOf(a).Name() + " and " + reflect.TypeOf(b).Name())
-	case float32:
-		if bt, ok := b.(float32); ok {
-			return float64Equal(float64(at), float64(bt)), nil
+		return 1, nil
+	}
+	cmp, err := interfacesCompare(a, b, strict)
+	if err != nil {
+		if strict {
+			return 0, err
 		}
+		return 0, nil
+	}
+	return cmp, nil
+}
+
+// interfacesIn() answers true if a equals any item in b, which must be
+// an array or slice. Equality is the same as interfacesEqual(); unless strict
+// is true, items that can't be compared are skipped, and anything that isn't
+// a collection has no items.
+func interfacesIn(a, b interface{}, strict bool) (bool, error) {
+	v := indirectValue(reflect.ValueOf(b))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return false, nil
+	case reflect.Array, reflect.Slice:
+	default:
 		if !strict {
-			return numbersEqual(float64(at), b)
+			return false, nil
 		}
-		return false, newMismatchError("types " + reflect.TypeOf(a).Name() + " and " + reflect.TypeOf(b).Name())
-	case float64:
-		if bt, ok := b.(float64); ok {
-			return float64Equal(at, bt), nil
+		return false, newMismatchError("in must have collection, not " + typeName(b))
+	}
+	for i := 0; i < v.Len(); i++ {
+		eq, err := interfacesEqual(a, valueInterface(v.Index(i)), strict)
+		if err != nil && strict {
+			return false, err
+		}
+		if eq {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// interfacesMatch() answers true if string a matches b according to the
+// operator: contains, startsWith, endsWith, or a regular expression match.
+// For a regular expression, b can be a pattern or a compiled *regexp.Regexp.
+// If strict is true, both sides must be strings. If it's false, anything
+// else doesn't match.
+func interfacesMatch(op symbol, a, b interface{}, strict bool) (bool, error) {
+	as, ok := a.(string)
+	if !ok {
+		if !strict {
+			return false, nil
 		}
+		return false, newMismatchError("can't match " + typeName(a))
+	}
+	if re, ok := b.(*regexp.Regexp); ok && op == matchToken {
+		return re.MatchString(as), nil
+	}
+	bs, ok := b.(string)
+	if !ok {
 		if !strict {
-			return numbersEqual(at, b)
+			return false, nil
 		}
-		return false, newMismatchError("types " + reflect.TypeOf(a).Name() + " and " + reflect.TypeOf(b).Name())
-	default:
-		return false, newUnhandledError("type " + reflect.TypeOf(a).Name())
+		return false, newMismatchError("can't match with " + typeName(b))
 	}
+	switch op {
+	case containsToken:
+		return strings.Contains(as, bs), nil
+	case startsWithToken:
+		return strings.HasPrefix(as, bs), nil
+	case endsWithToken:
+		return strings.HasSuffix(as, bs), nil
+	case matchToken:
+		re, err := regexp.Compile(bs)
+		if err != nil {
+			return false, newWrappedError(evalErrCode, "pattern "+bs, err)
+		}
+		return re.MatchString(as), nil
+	}
+	return false, newUnhandledError("match " + tokenMap[op].Text)
 }
 
 // ------------------------------------------------------------
 // MISC
 
-func numbersEqual(a float64, b interface{}) (bool, error) {
-	switch bt := b.(type) {
-	case int:
-		return float64Equal(a, float64(bt)), nil
-	case float32:
-		return float64Equal(a, float64(bt)), nil
-	case float64:
-		return float64Equal(a, bt), nil
-	default:
-		return false, newUnhandledError("type " + reflect.TypeOf(a).Name())
+// numbersCompare() orders two numbers of any kind. Integers are compared
+// exactly, even when one is signed and the other isn't; if either is a
+// float, both are compared as float64s.
+func numbersCompare(a, b reflect.Value) int {
+	switch {
+	case isIntKind(a.Kind()) && isIntKind(b.Kind()):
+		return int64Compare(a.Int(), b.Int())
+	case isUintKind(a.Kind()) && isUintKind(b.Kind()):
+		return uint64Compare(a.Uint(), b.Uint())
+	case isIntKind(a.Kind()) && isUintKind(b.Kind()):
+		if a.Int() < 0 {
+			return -1
+		}
+		return uint64Compare(uint64(a.Int()), b.Uint())
+	case isUintKind(a.Kind()) && isIntKind(b.Kind()):
+		return -numbersCompare(b, a)
+	}
+	return float64Compare(floatValue(a), floatValue(b))
+}
+
+func int64Compare(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func uint64Compare(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// float64Compare() orders two floats, using the same tolerance as float64Equal().
+func float64Compare(a, b float64) int {
+	if float64Equal(a, b) {
+		return 0
+	} else if a < b {
+		return -1
+	}
+	return 1
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// floatValue() answers number v as a float64, whatever its kind.
+func floatValue(v reflect.Value) float64 {
+	switch {
+	case isIntKind(v.Kind()):
+		return float64(v.Int())
+	case isUintKind(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
 	}
+	return false
 }
 
 func float64Equal(a, b float64) bool {
@@ -60,7 +60,23 @@ func (n *nodeT) canHaveSelect() bool {
 	if n.Parent == nil || n.Parent.Token.Symbol != pathToken {
 		return false
 	}
-	return n.Token.any(selectNeededFields...)
+	return n.isCondition()
+}
+
+// isCondition() answers true if I'm a condition on an item, which includes
+// && and || when either side is one, i.e. (/Age >= 18 && /Age < 65).
+func (n *nodeT) isCondition() bool {
+	if n.Token.any(selectNeededFields...) {
+		return true
+	}
+	if n.Token.any(andToken, orToken) {
+		for _, c := range n.Children {
+			if c.isCondition() {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (n *nodeT) doesNotNeedSelect() bool {
@@ -86,7 +102,7 @@ type selectContext struct {
 // CONST and VAR
 
 var (
-	selectNeededFields    = []symbol{eqlToken, neqToken}
+	selectNeededFields    = []symbol{eqlToken, neqToken, ltToken, lteToken, gtToken, gteToken, containsToken, startsWithToken, endsWithToken, matchToken, inToken, notToken}
 	selectNotNeededFields = []symbol{assignToken}
 )
 
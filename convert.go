@@ -0,0 +1,287 @@
+package sqi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ------------------------------------------------------------
+// CONVERT
+
+// convertValue() answers v as a value of type rt. Values that are assignable
+// are used directly. Otherwise numbers are converted between types if the
+// value fits, as in convertNumber(), slices, arrays and maps are converted
+// element by element, maps and structs are converted to structs field by
+// field, and pointers are followed or allocated. A nil value converts to the
+// zero value of any type that can be nil, and a value that contains itself is
+// an error. Errors name the path to the value that failed, i.e. [1].Age.
+func convertValue(v reflect.Value, rt reflect.Type, opt *Opt) (reflect.Value, error) {
+	return convertAt(v, rt, "", make(map[visitKey]bool), opt)
+}
+
+// convertAt() converts the value at path. References are tracked while
+// they're being converted to guard against cycles.
+func convertAt(v reflect.Value, rt reflect.Type, path string, visited map[visitKey]bool, opt *Opt) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		switch rt.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			return reflect.Zero(rt), nil
+		}
+		return reflect.Value{}, convertError(path, "can't convert nil to "+rt.String())
+	}
+	if v.Type().AssignableTo(rt) {
+		return v, nil
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return convertAt(reflect.Value{}, rt, path, visited, opt)
+	}
+	if v.Kind() == reflect.Ptr && rt.Kind() != reflect.Ptr {
+		if !visit(v, visited) {
+			return reflect.Value{}, cycleError(path, v)
+		}
+		defer unvisit(v, visited)
+		return convertAt(v.Elem(), rt, path, visited, opt)
+	}
+	switch {
+	case rt.Kind() == reflect.Ptr:
+		elem, err := convertAt(v, rt.Elem(), path, visited, opt)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(rt.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case isNumberKind(v.Kind()) && isNumberKind(rt.Kind()):
+		return convertNumber(v, rt, path)
+	case v.Kind() == rt.Kind() && (rt.Kind() == reflect.String || rt.Kind() == reflect.Bool):
+		return v.Convert(rt), nil
+	case rt.Kind() == reflect.Slice && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return reflect.Zero(rt), nil
+			}
+			if !visit(v, visited) {
+				return reflect.Value{}, cycleError(path, v)
+			}
+			defer unvisit(v, visited)
+		}
+		dst := reflect.MakeSlice(rt, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := convertAt(v.Index(i), rt.Elem(), path+"["+strconv.Itoa(i)+"]", visited, opt)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			dst = reflect.Append(dst, item)
+		}
+		return dst, nil
+	case rt.Kind() == reflect.Map && v.Kind() == reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(rt), nil
+		}
+		if !visit(v, visited) {
+			return reflect.Value{}, cycleError(path, v)
+		}
+		defer unvisit(v, visited)
+		dst := reflect.MakeMapWithSize(rt, v.Len())
+		for _, key := range sortedMapKeys(v) {
+			keypath := path + "[" + fmt.Sprint(valueInterface(key)) + "]"
+			k, err := convertAt(key, rt.Key(), keypath, visited, opt)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			item, err := convertAt(v.MapIndex(key), rt.Elem(), keypath, visited, opt)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			dst.SetMapIndex(k, item)
+		}
+		return dst, nil
+	case rt.Kind() == reflect.Struct && v.Kind() == reflect.Map:
+		if !visit(v, visited) {
+			return reflect.Value{}, cycleError(path, v)
+		}
+		defer unvisit(v, visited)
+		return convertMapToStruct(v, rt, path, visited, opt)
+	case rt.Kind() == reflect.Struct && v.Kind() == reflect.Struct:
+		return convertStructToStruct(v, rt, path, visited, opt)
+	}
+	return reflect.Value{}, convertError(path, "can't convert "+v.Type().String()+" to "+rt.String())
+}
+
+// convertMapToStruct() answers a struct of type rt with each field set from
+// the map entry of the same name. Fields are named as in paths, so opt.Tag
+// and opt.IgnoreCase apply. Entries without a field are ignored.
+func convertMapToStruct(v reflect.Value, rt reflect.Type, path string, visited map[visitKey]bool, opt *Opt) (reflect.Value, error) {
+	dst := reflect.New(rt).Elem()
+	for _, key := range sortedMapKeys(v) {
+		if key.Kind() != reflect.String {
+			continue
+		}
+		if err := convertField(dst, key.String(), v.MapIndex(key), path, visited, opt); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return dst, nil
+}
+
+// convertStructToStruct() answers a struct of type rt with each field set
+// from the exported field of v with the same Go name. Fields without a match
+// are ignored.
+func convertStructToStruct(v reflect.Value, rt reflect.Type, path string, visited map[visitKey]bool, opt *Opt) (reflect.Value, error) {
+	// Struct fields are matched by Go name, not by any tag.
+	plain := &Opt{Strict: opt.Strict, IgnoreCase: opt.IgnoreCase}
+	dst := reflect.New(rt).Elem()
+	tf := typeFieldsFor(v.Type(), "")
+	for _, name := range tf.names {
+		src := fieldByIndex(v, tf.byName[name])
+		if !src.IsValid() {
+			continue
+		}
+		if err := convertField(dst, name, src, path, visited, plain); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return dst, nil
+}
+
+// convertField() sets the field of struct dst with the given name to src.
+func convertField(dst reflect.Value, name string, src reflect.Value, path string, visited map[visitKey]bool, opt *Opt) error {
+	index, err := fieldIndex(dst.Type(), name, opt)
+	if err != nil || index == nil {
+		return err
+	}
+	f := fieldByIndexAlloc(dst, index)
+	if !f.IsValid() || !f.CanSet() {
+		return nil
+	}
+	val, err := convertAt(src, f.Type(), path+"."+name, visited, opt)
+	if err != nil {
+		return err
+	}
+	f.Set(val)
+	return nil
+}
+
+// convertError() answers a mismatch error for the value at path.
+func convertError(path, msg string) error {
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	return newMismatchError(msg)
+}
+
+// cycleError() answers the error for reference v at path, which
+// contains itself.
+func cycleError(path string, v reflect.Value) error {
+	return convertError(path, "cycle converting "+v.Type().String())
+}
+
+// convertNumber() answers number v as a number of type rt, or an error if
+// the value doesn't fit: it overflows, it's negative and rt is unsigned, it
+// has a fraction and rt is an integer, or it's an integer that rt can't hold
+// exactly. A float converted to a float32 is rounded to the nearest float32,
+// as Go does, since few decimal fractions, such as 0.1, are exact in either.
+func convertNumber(v reflect.Value, rt reflect.Type, path string) (reflect.Value, error) {
+	dst := reflect.New(rt).Elem()
+	fail := func(why string) (reflect.Value, error) {
+		return reflect.Value{}, convertError(path, why+" converting "+v.Type().String()+" to "+rt.String())
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case isFloatKind(rt.Kind()):
+			if !math.IsInf(f, 0) && !math.IsNaN(f) && dst.OverflowFloat(f) {
+				return fail("overflow")
+			}
+			dst.SetFloat(f)
+			return dst, nil
+		case math.IsInf(f, 0) || math.IsNaN(f):
+			return fail("infinity or NaN")
+		case f != math.Trunc(f):
+			return fail("fraction")
+		case isUintKind(rt.Kind()):
+			if f < 0 || f >= math.Ldexp(1, rt.Bits()) {
+				return fail("overflow")
+			}
+			dst.SetUint(uint64(f))
+			return dst, nil
+		default:
+			if f < -math.Ldexp(1, rt.Bits()-1) || f >= math.Ldexp(1, rt.Bits()-1) {
+				return fail("overflow")
+			}
+			dst.SetInt(int64(f))
+			return dst, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		switch {
+		case isFloatKind(rt.Kind()):
+			f := roundFloat(float64(u), rt)
+			if f >= math.Ldexp(1, 64) || uint64(f) != u {
+				return fail("precision")
+			}
+			dst.SetFloat(f)
+		case isUintKind(rt.Kind()):
+			if dst.OverflowUint(u) {
+				return fail("overflow")
+			}
+			dst.SetUint(u)
+		default:
+			if u > math.MaxInt64 || dst.OverflowInt(int64(u)) {
+				return fail("overflow")
+			}
+			dst.SetInt(int64(u))
+		}
+		return dst, nil
+	default:
+		i := v.Int()
+		switch {
+		case isFloatKind(rt.Kind()):
+			f := roundFloat(float64(i), rt)
+			if f >= math.Ldexp(1, 63) || int64(f) != i {
+				return fail("precision")
+			}
+			dst.SetFloat(f)
+		case isUintKind(rt.Kind()):
+			if i < 0 || dst.OverflowUint(uint64(i)) {
+				return fail("overflow")
+			}
+			dst.SetUint(uint64(i))
+		default:
+			if dst.OverflowInt(i) {
+				return fail("overflow")
+			}
+			dst.SetInt(i)
+		}
+		return dst, nil
+	}
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// roundFloat() answers f rounded to the precision of float type rt.
+func roundFloat(f float64, rt reflect.Type) float64 {
+	if rt.Kind() == reflect.Float32 {
+		return float64(float32(f))
+	}
+	return f
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
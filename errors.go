@@ -1,5 +1,9 @@
 package sqi
 
+import (
+	"fmt"
+)
+
 var (
 	badRequestErr = newBadRequestError("")
 	conditionErr  = newConditionError("")
@@ -41,6 +45,10 @@ func newUnhandledError(msg string) error {
 	return &sqiErr{unhandledErrCode, msg, nil}
 }
 
+func newWrappedError(code int, msg string, err error) error {
+	return &sqiErr{code, msg, err}
+}
+
 type sqiErr struct {
 	code int
 	msg  string
@@ -93,6 +101,14 @@ func mergeErrors(err ...error) error {
 	return nil
 }
 
+// recoverError() turns a panic into an eval error in err, so that
+// evaluating never panics on unexpected input. It must be deferred.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = newEvalError(fmt.Sprint("recovered from ", r))
+	}
+}
+
 // --------------------------------
 // CONST and VAR
 
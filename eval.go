@@ -7,15 +7,73 @@ import (
 // ------------------------------------------------------------
 // EVAL
 
-// Eval runs term against input, returning the result.
+// Eval runs term against input, returning the result. Terms are
+// compiled once and kept in a cache; see SetCache().
 func Eval(term string, input interface{}, opt *Opt) (interface{}, error) {
-	expr, err := MakeExpr(term)
+	expr, err := makeExpr(term, opt)
 	if err != nil {
 		return nil, err
 	}
 	return expr.Eval(input, opt)
 }
 
+// EvalAs runs term against input, returning the result as a T. Numbers are
+// converted between types if the value fits, so a float64 from JSON can be
+// read as an int, but 1.5 or 300 can't be read as an int8. Slices and maps
+// are converted element by element, and structs field by field. A nil
+// result is the zero value of a T that can be nil, otherwise it's an error.
+func EvalAs[T any](term string, input interface{}, opt *Opt) (T, error) {
+	var ans T
+	resp, err := Eval(term, input, opt)
+	if err != nil {
+		return ans, err
+	}
+	if opt == nil {
+		opt = &Opt{}
+	}
+	v, err := convertValue(reflect.ValueOf(resp), reflect.TypeOf(&ans).Elem(), opt)
+	if err != nil {
+		return ans, err
+	}
+	reflect.ValueOf(&ans).Elem().Set(v)
+	return ans, nil
+}
+
+// EvalOr is EvalAs, except it answers def along with any error.
+func EvalOr[T any](term string, input interface{}, def T, opt *Opt) (T, error) {
+	ans, err := EvalAs[T](term, input, opt)
+	if err != nil {
+		return def, err
+	}
+	return ans, nil
+}
+
+// EvalInto runs term against input, storing the result in the value dst
+// points to. The result is assigned directly if it can be, otherwise it's
+// converted as with EvalAs. When a map is converted to a struct, the keys
+// name fields the way paths do, so opt.Tag and opt.IgnoreCase apply. A
+// conversion error names the path to the value that failed, and dst is
+// left unchanged.
+func EvalInto(term string, input interface{}, dst interface{}, opt *Opt) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return newBadRequestError("EvalInto must have a non-nil pointer")
+	}
+	resp, err := Eval(term, input, opt)
+	if err != nil {
+		return err
+	}
+	if opt == nil {
+		opt = &Opt{}
+	}
+	v, err := convertValue(reflect.ValueOf(resp), rv.Elem().Type(), opt)
+	if err != nil {
+		return err
+	}
+	rv.Elem().Set(v)
+	return nil
+}
+
 // EvalBool runs term against input, returning the boolean result.
 // If an error occurs, the opt.OnError is returned.
 func EvalBool(term string, input interface{}, opt *Opt) bool {
@@ -175,6 +233,27 @@ type Opt struct {
 	// OnError is a value returned when one of the typed Eval() statements returns an error.
 	// Must match the type. For example, the value must be assigend a string if using EvalString().
 	OnError interface{}
+	// Funcs are functions available to expressions, in addition to the global functions.
+	// They are resolved when the expression is made, so they only apply to MakeExprOpt()
+	// and the Eval() functions.
+	Funcs *Funcs
+	// Params are the values for named parameters, which appear as $name in expressions.
+	Params map[string]interface{}
+	// Args are the values for positional parameters, which appear as ? in expressions.
+	// Each ? is assigned the next arg.
+	Args []interface{}
+	// Tag names a struct tag key, such as "json", that names struct fields in
+	// paths. Fields are named the way encoding/json names them, so the same
+	// expression works on a struct and on its hydrated json.
+	Tag string
+	// IgnoreCase causes paths that don't exactly match a struct field or map key
+	// to match one that differs only by case. If more than one does, the first is
+	// used, unless Strict is set, in which case it's an error.
+	IgnoreCase bool
+	// Methods causes paths that don't match a struct field to call a getter
+	// method of the same name. It's off by default, so an expression can't call
+	// methods unless the caller allows it.
+	Methods bool
 }
 
 func (o Opt) onErrorBool() bool {
@@ -10,6 +10,12 @@ type Expr interface {
 
 // MakeExpr converts an expression string into an evaluatable object.
 func MakeExpr(term string) (Expr, error) {
+	return MakeExprOpt(term, nil)
+}
+
+// MakeExprOpt converts an expression string into an evaluatable object.
+// Functions are found in opt.Funcs before the global functions.
+func MakeExprOpt(term string, opt *Opt) (Expr, error) {
 	tokens, err := scan(term)
 	if err != nil {
 		return nil, err
@@ -25,7 +31,11 @@ func MakeExpr(term string) (Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	ast, err := tree.asAst()
+	args := &astArgs{}
+	if opt != nil {
+		args.funcs = opt.Funcs
+	}
+	ast, err := tree.asAst(args)
 	if err != nil {
 		return nil, err
 	}
@@ -39,9 +49,37 @@ type exprT struct {
 	ast AstNode
 }
 
-func (e *exprT) Eval(input interface{}, opt *Opt) (interface{}, error) {
+func (e *exprT) Eval(input interface{}, opt *Opt) (_ interface{}, err error) {
+	defer recoverError(&err)
 	if e.ast == nil {
 		return nil, newEvalError("missing AST")
 	}
-	return e.ast.Eval(input, opt)
+	// AST nodes require options.
+	if opt == nil {
+		opt = &Opt{}
+	}
+	return e.ast.Eval(input, opt, scopeT{})
+}
+
+// --------------------------------------------------------------------------------------
+// BOUND-EXPR-T
+
+// boundExprT is an Expr handed to a function. When evaluated
+// without options it uses the options of the caller. It always
+// uses the scope of the caller, so @key is the selected item's.
+type boundExprT struct {
+	ast   AstNode
+	opt   *Opt
+	scope scopeT
+}
+
+func (e *boundExprT) Eval(input interface{}, opt *Opt) (_ interface{}, err error) {
+	defer recoverError(&err)
+	if opt == nil {
+		opt = e.opt
+	}
+	if opt == nil {
+		opt = &Opt{}
+	}
+	return e.ast.Eval(input, opt, e.scope)
 }
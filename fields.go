@@ -0,0 +1,431 @@
+package sqi
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// FIELD LOOKUP
+
+// findField() answers the field of struct v with the given name, or an
+// invalid value if there isn't one. If opt.Tag is set, fields are named
+// by that tag the way encoding/json names them. If opt.IgnoreCase is set
+// and there's no exact match, any field whose name differs only by case
+// is answered; in strict mode, more than one is an error.
+func findField(v reflect.Value, name string, opt *Opt) (reflect.Value, error) {
+	index, err := fieldIndex(v.Type(), name, opt)
+	if err != nil || index == nil {
+		return reflect.Value{}, err
+	}
+	return fieldValue(v, index), nil
+}
+
+// fieldIndex() answers the index of the field of struct type rt with the
+// given name, or nil if there isn't one. Names are resolved as in findField().
+func fieldIndex(rt reflect.Type, name string, opt *Opt) ([]int, error) {
+	return fieldPlanFor(rt, name, opt).resolve(name, opt)
+}
+
+// findMapKey() answers the key of map v that differs from name only by
+// case, or an invalid value if there isn't one. If more than one key
+// matches, the first in key order is answered; in strict mode it's an error.
+func findMapKey(v reflect.Value, name string, opt *Opt) (reflect.Value, error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}, nil
+	}
+	// One pass that keeps the smallest match, so the keys aren't
+	// copied or sorted for every lookup.
+	var it reflect.MapIter
+	it.Reset(v)
+	key := reflect.New(v.Type().Key()).Elem()
+	found, count := "", 0
+	for it.Next() {
+		key.SetIterKey(&it)
+		if s := key.String(); strings.EqualFold(s, name) {
+			if count == 0 || s < found {
+				found = s
+			}
+			count++
+		}
+	}
+	if count < 1 {
+		return reflect.Value{}, nil
+	}
+	if count > 1 && opt.Strict {
+		return reflect.Value{}, newEvalError("ambiguous key " + name)
+	}
+	key.SetString(found)
+	return key, nil
+}
+
+// findMethod() answers the getter method of v with the given name, or an
+// invalid value if there isn't one. A getter is exported, takes no arguments,
+// and answers a value, or a value and an error. Methods with pointer receivers
+// are called on v's address, or on a copy if v isn't addressable.
+func findMethod(v reflect.Value, name string) reflect.Value {
+	m := v.MethodByName(name)
+	if !m.IsValid() && v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+		p := reflect.New(v.Type())
+		if v.CanAddr() {
+			p = v.Addr()
+		} else {
+			p.Elem().Set(v)
+		}
+		m = p.MethodByName(name)
+	}
+	if !m.IsValid() || !isGetter(m.Type()) {
+		return reflect.Value{}
+	}
+	return m
+}
+
+// callGetter() answers the value of getter method m. An error answered
+// by the method becomes an eval error.
+func callGetter(m reflect.Value, name string) (reflect.Value, error) {
+	out := m.Call(nil)
+	if len(out) > 1 && !out[1].IsNil() {
+		return reflect.Value{}, newWrappedError(evalErrCode, "method "+name, out[1].Interface().(error))
+	}
+	return out[0], nil
+}
+
+// isGetter() answers true if method type mt can be called as a path step.
+// It must answer a value, so a method that only answers an error, such as
+// Close(), isn't a getter.
+func isGetter(mt reflect.Type) bool {
+	if mt.NumIn() != 0 || mt.NumOut() < 1 || mt.Out(0) == errorType {
+		return false
+	}
+	switch mt.NumOut() {
+	case 1:
+		return true
+	case 2:
+		return mt.Out(1) == errorType
+	}
+	return false
+}
+
+// mapKey() answers name converted to the key type of map m, and false if
+// it can't be. Keys that implement encoding.TextUnmarshaler are parsed by it;
+// otherwise strings, numbers and bools are converted. For interface{} keys,
+// as produced by YAML decoders, name is tried as a string and then as a
+// number, and the first that's in the map is answered.
+func mapKey(m reflect.Value, name string) (reflect.Value, bool) {
+	kt := m.Type().Key()
+	if reflect.PtrTo(kt).Implements(textUnmarshalerType) {
+		key := reflect.New(kt)
+		if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name)); err != nil {
+			return reflect.Value{}, false
+		}
+		return key.Elem(), true
+	}
+	switch kt.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(name).Convert(kt), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, kt.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(i).Convert(kt), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, kt.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(u).Convert(kt), true
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(name, kt.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(f).Convert(kt), true
+	case reflect.Bool:
+		b, err := strconv.ParseBool(name)
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(b), true
+	case reflect.Interface:
+		keys := []reflect.Value{reflect.ValueOf(name)}
+		if i, err := strconv.Atoi(name); err == nil {
+			keys = append(keys, reflect.ValueOf(i))
+		}
+		if f, err := strconv.ParseFloat(name, 64); err == nil {
+			keys = append(keys, reflect.ValueOf(f))
+		}
+		for _, key := range keys {
+			if key.Type().AssignableTo(kt) && m.MapIndex(key).IsValid() {
+				return key, true
+			}
+		}
+		return keys[0], keys[0].Type().AssignableTo(kt)
+	}
+	return reflect.Value{}, false
+}
+
+// ------------------------------------------------------------
+// FIELD-PLAN-T
+
+// fieldPlanT is how a name resolves to a field of a struct type, for one
+// tag and case option. Plans are made the first time a type is evaluated,
+// and cached, so repeated lookups on the same type just follow the index.
+type fieldPlanT struct {
+	rt         reflect.Type
+	tag        string
+	ignoreCase bool
+	index      []int // nil if there's no field
+	ambiguous  bool  // More than one field matched, ignoring case
+}
+
+type fieldPlanKey struct {
+	rt         reflect.Type
+	name       string
+	tag        string
+	ignoreCase bool
+}
+
+// fieldPlanFor() answers the plan for name on struct type rt. Plans are
+// cached if they find a field, so names that come from data, and miss,
+// don't grow the cache.
+func fieldPlanFor(rt reflect.Type, name string, opt *Opt) *fieldPlanT {
+	key := fieldPlanKey{rt: rt, name: name}
+	if opt != nil {
+		key.tag, key.ignoreCase = opt.Tag, opt.IgnoreCase
+	}
+	if found, ok := fieldPlanCache.Load(key); ok {
+		return found.(*fieldPlanT)
+	}
+	plan := newFieldPlan(key)
+	if plan.index == nil {
+		return plan
+	}
+	found, _ := fieldPlanCache.LoadOrStore(key, plan)
+	return found.(*fieldPlanT)
+}
+
+func newFieldPlan(key fieldPlanKey) *fieldPlanT {
+	plan := &fieldPlanT{rt: key.rt, tag: key.tag, ignoreCase: key.ignoreCase}
+	if key.tag == "" {
+		if sf, ok := key.rt.FieldByName(key.name); ok && sf.PkgPath == "" {
+			plan.index = sf.Index
+		}
+	} else {
+		plan.index = typeFieldsFor(key.rt, key.tag).byName[key.name]
+	}
+	if plan.index != nil || !key.ignoreCase {
+		return plan
+	}
+	found := typeFieldsFor(key.rt, key.tag).byFold[strings.ToLower(key.name)]
+	if len(found) > 0 {
+		plan.index, plan.ambiguous = found[0], len(found) > 1
+	}
+	return plan
+}
+
+// matches() answers true if I'm the plan for type rt with these options.
+func (p *fieldPlanT) matches(rt reflect.Type, opt *Opt) bool {
+	return p.rt == rt && p.tag == opt.Tag && p.ignoreCase == opt.IgnoreCase
+}
+
+// resolve() answers my field index, which is an error if it's
+// ambiguous and opt is strict.
+func (p *fieldPlanT) resolve(name string, opt *Opt) ([]int, error) {
+	if p.ambiguous && opt != nil && opt.Strict {
+		return nil, newEvalError("ambiguous field " + name)
+	}
+	return p.index, nil
+}
+
+// ------------------------------------------------------------
+// TYPE-FIELDS-T
+
+// typeFieldsT describes how names resolve to the fields of a struct
+// type for a single tag key. They're built once per type and tag.
+type typeFieldsT struct {
+	// names are the field names, shallowest first and then in field order.
+	names  []string
+	byName map[string][]int
+	// byFold has every field for each lowercase name, in field order.
+	byFold map[string][][]int
+}
+
+type typeFieldsKey struct {
+	rt  reflect.Type
+	tag string
+}
+
+// typeFieldsFor() answers the cached fields for struct type rt.
+func typeFieldsFor(rt reflect.Type, tag string) *typeFieldsT {
+	key := typeFieldsKey{rt, tag}
+	if found, ok := typeFieldsCache.Load(key); ok {
+		return found.(*typeFieldsT)
+	}
+	tf := newTypeFields(rt, tag)
+	found, _ := typeFieldsCache.LoadOrStore(key, tf)
+	return found.(*typeFieldsT)
+}
+
+// newTypeFields() walks rt and any embedded structs, breadth first. As in
+// encoding/json, a shallower field hides deeper fields of the same name,
+// and fields of the same name at the same depth hide each other unless
+// exactly one is tagged.
+func newTypeFields(rt reflect.Type, tag string) *typeFieldsT {
+	type candidate struct {
+		index  []int
+		tagged bool
+		count  int
+	}
+	var names []string
+	byName := make(map[string][]int)
+	byFold := make(map[string][][]int)
+	seen := make(map[string]bool)
+	current := [][]int{nil}
+	visited := map[reflect.Type]bool{}
+	for len(current) > 0 {
+		var next [][]int
+		level := make(map[string]*candidate)
+		var order []string
+		for _, parent := range current {
+			st := rt
+			if len(parent) > 0 {
+				st = rt.FieldByIndex(parent).Type
+				if st.Kind() == reflect.Ptr {
+					st = st.Elem()
+				}
+			}
+			if visited[st] {
+				continue
+			}
+			visited[st] = true
+			for i := 0; i < st.NumField(); i++ {
+				f := st.Field(i)
+				index := append(append([]int{}, parent...), i)
+				name, tagged := tagName(f, tag)
+				if name == "" {
+					continue
+				}
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				// Untagged embedded structs are flattened into their parent.
+				if f.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+					next = append(next, index)
+					continue
+				}
+				if f.PkgPath != "" {
+					continue
+				}
+				if seen[name] {
+					continue
+				}
+				c, ok := level[name]
+				if !ok {
+					level[name] = &candidate{index: index, tagged: tagged, count: 1}
+					order = append(order, name)
+				} else if tagged && !c.tagged {
+					c.index, c.tagged, c.count = index, true, 1
+				} else if tagged == c.tagged {
+					c.count++
+				}
+			}
+		}
+		for _, name := range order {
+			seen[name] = true
+			if c := level[name]; c.count == 1 {
+				names = append(names, name)
+				byName[name] = c.index
+				fold := strings.ToLower(name)
+				byFold[fold] = append(byFold[fold], c.index)
+			}
+		}
+		current = next
+	}
+	return &typeFieldsT{names: names, byName: byName, byFold: byFold}
+}
+
+// ------------------------------------------------------------
+// MISC
+
+// tagName() answers the name of a struct field for the tag, and whether
+// the tag supplied it. The name is empty if the tag excludes the field.
+func tagName(f reflect.StructField, tag string) (string, bool) {
+	if tag == "" {
+		return f.Name, false
+	}
+	value, ok := f.Tag.Lookup(tag)
+	if !ok {
+		return f.Name, false
+	}
+	if value == "-" {
+		return "", false
+	}
+	if idx := strings.Index(value, ","); idx >= 0 {
+		value = value[:idx]
+	}
+	if value == "" {
+		return f.Name, false
+	}
+	return value, true
+}
+
+// fieldValue() answers the field of v at index. If the field is
+// behind a nil embedded pointer, it answers a nil interface value.
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	if f := fieldByIndex(v, index); f.IsValid() {
+		return f
+	}
+	return reflect.Zero(interfaceType)
+}
+
+// fieldByIndex() is reflect.Value.FieldByIndex(), except it answers
+// an invalid value instead of panicking on a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// fieldByIndexAlloc() is reflect.Value.FieldByIndex(), except it
+// allocates any nil embedded pointers. v must be settable. It answers
+// an invalid value if a pointer can't be allocated.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	// typeFieldsCache holds a *typeFieldsT for each typeFieldsKey.
+	typeFieldsCache sync.Map
+	// fieldPlanCache holds a *fieldPlanT for each fieldPlanKey.
+	fieldPlanCache sync.Map
+
+	interfaceType       = reflect.TypeOf((*interface{})(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
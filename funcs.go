@@ -0,0 +1,176 @@
+package sqi
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ------------------------------------------------------------
+// FUNCS
+
+// Funcs is a collection of functions that can be called from expressions.
+// A function can be any Go func that answers a single value, or a value and
+// an error. Arguments are converted to the parameter types the same way
+// values are assigned: unless Opt.Strict is set, numbers convert between types.
+//
+// A parameter of type Expr receives its argument unevaluated, which lets the
+// function evaluate it against values of its choosing (for example, every
+// item in a collection). A nil opt supplied to that Expr uses the caller's options.
+type Funcs struct {
+	mutex sync.RWMutex
+	funcs map[string]*funcT
+	gen   uint64 // Changes whenever a function is added
+}
+
+// NewFuncs answers a new, empty function collection.
+func NewFuncs() *Funcs {
+	return &Funcs{funcs: make(map[string]*funcT)}
+}
+
+// Add makes fn callable by name, replacing any existing function.
+func (f *Funcs) Add(name string, fn interface{}) error {
+	if name == "" {
+		return newBadRequestError("function must have name")
+	}
+	ft, err := newFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.funcs[name] = ft
+	f.gen++
+	return nil
+}
+
+func (f *Funcs) find(name string) *funcT {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.funcs[name]
+}
+
+func (f *Funcs) generation() uint64 {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.gen
+}
+
+// RegisterFunc makes fn callable by name from all expressions.
+// See Funcs for the requirements on fn.
+func RegisterFunc(name string, fn interface{}) error {
+	return globalFuncs.Add(name, fn)
+}
+
+// ------------------------------------------------------------
+// FUNC-T
+
+// funcT is a single callable function.
+type funcT struct {
+	name string
+	fn   reflect.Value
+}
+
+func newFunc(name string, fn interface{}) (*funcT, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, newBadRequestError("function " + name + " must be a func")
+	}
+	rt := v.Type()
+	switch rt.NumOut() {
+	case 1:
+	case 2:
+		if rt.Out(1) != errorType {
+			return nil, newBadRequestError("function " + name + " second result must be error")
+		}
+	default:
+		return nil, newBadRequestError("function " + name + " must answer one value, or a value and error")
+	}
+	return &funcT{name: name, fn: v}, nil
+}
+
+// check() validates args against my parameters. Only constant args
+// can have their types validated.
+func (f *funcT) check(args []AstNode) error {
+	rt := f.fn.Type()
+	if rt.IsVariadic() {
+		if len(args) < rt.NumIn()-1 {
+			return newParseError(f.name + " needs at least " + strconv.Itoa(rt.NumIn()-1) + " args")
+		}
+	} else if len(args) != rt.NumIn() {
+		return newParseError(f.name + " needs " + strconv.Itoa(rt.NumIn()) + " args")
+	}
+	for i, arg := range args {
+		c, ok := arg.(*constantNode)
+		if !ok || f.param(i) == exprType {
+			continue
+		}
+		if _, err := assignableValue(c.Value, f.param(i), false); err != nil {
+			return newParseError(f.name + " arg " + strconv.Itoa(i+1) + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// param() answers the type of parameter i, unpacking variadics.
+func (f *funcT) param(i int) reflect.Type {
+	rt := f.fn.Type()
+	if rt.IsVariadic() && i >= rt.NumIn()-1 {
+		return rt.In(rt.NumIn() - 1).Elem()
+	}
+	return rt.In(i)
+}
+
+// call() runs the function on args, which have already been checked.
+func (f *funcT) call(args []reflect.Value) (interface{}, error) {
+	out := f.fn.Call(args)
+	if len(out) > 1 && !out[1].IsNil() {
+		return nil, newWrappedError(evalErrCode, "function "+f.name, out[1].Interface().(error))
+	}
+	return valueInterface(out[0]), nil
+}
+
+// ------------------------------------------------------------
+// BUILT-INS
+
+// newBuiltinFuncs() answers the functions available to all expressions.
+func newBuiltinFuncs() *Funcs {
+	f := NewFuncs()
+	f.Add("len", builtinLen)
+	f.Add("lower", strings.ToLower)
+	f.Add("upper", strings.ToUpper)
+	// Aggregates
+	f.Add("count", builtinCount)
+	f.Add("sum", builtinSum)
+	f.Add("avg", builtinAvg)
+	f.Add("min", builtinMin)
+	f.Add("max", builtinMax)
+	// Grouping
+	f.Add("distinct", builtinDistinct)
+	f.Add("groupBy", builtinGroupBy)
+	return f
+}
+
+// builtinLen() answers the length of a string, array, slice or map.
+func builtinLen(i interface{}) (int, error) {
+	v := indirectValue(reflect.ValueOf(i))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0, nil
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return v.Len(), nil
+	}
+	return 0, errors.New("len must have string, array, slice or map")
+}
+
+// ------------------------------------------------------------
+// CONST and VAR
+
+var (
+	globalFuncs = newBuiltinFuncs()
+
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	exprType  = reflect.TypeOf((*Expr)(nil)).Elem()
+)
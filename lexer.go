@@ -1,6 +1,7 @@
 package sqi
 
 import (
+	"strconv"
 	"strings"
 	"text/scanner"
 	"unicode"
@@ -12,7 +13,7 @@ func scan(input string) ([]*nodeT, error) {
 	lexer.Init(strings.NewReader(input))
 	// lexer.Whitespace = 1<<'\r' | 1<<'\t'
 	lexer.Whitespace = 0
-	lexer.Mode = scanner.ScanChars | scanner.ScanComments | scanner.ScanFloats | scanner.ScanIdents | scanner.ScanInts | scanner.ScanRawStrings | scanner.ScanStrings
+	lexer.Mode = scanner.ScanChars | scanner.ScanFloats | scanner.ScanIdents | scanner.ScanInts | scanner.ScanRawStrings | scanner.ScanStrings
 
 	runer := &runerT{}
 	lexer.IsIdentRune = runer.isIdentRune
@@ -28,19 +29,18 @@ func scan(input string) ([]*nodeT, error) {
 			runer.addToken(newNode(intToken, lexer.TokenText()))
 		case scanner.Ident:
 			runer.flush()
-			runer.addString(lexer.TokenText())
+			runer.addIdent(lexer.TokenText())
 		case scanner.String:
 			runer.flush()
 			runer.addString(lexer.TokenText())
 		case ' ', '\r', '\t', '\n': // whitespace
 			runer.flush()
-		case scanner.Comment:
-			runer.flush()
 		default:
 			runer.accumulate(tok)
 		}
 	}
 	runer.flush()
+	runer.numberParams()
 	return runer.tokens, nil
 }
 
@@ -59,7 +59,23 @@ func (r *runerT) isIdentRune(ch rune, i int) bool {
 	// when there's no whitespace separating them from idents, but I can't
 	// see any way the scanner would support that behaviour.
 	systemident := ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch) && i > 0
-	return systemident
+	// Named parameters are idents that start with $, and
+	// the pseudo-fields of selects are idents that start with @
+	return systemident || (ch == '$' || ch == '@') && i == 0
+}
+
+// addIdent() adds an unquoted word, which is a string unless it names a
+// parameter or pseudo-field.
+func (r *runerT) addIdent(s string) {
+	if strings.HasPrefix(s, "$") {
+		r.addToken(newNode(paramToken, s))
+		return
+	}
+	if strings.HasPrefix(s, "@") {
+		r.addToken(newNode(scopeToken, s))
+		return
+	}
+	r.addString(s)
 }
 
 func (r *runerT) addString(s string) {
@@ -71,14 +87,9 @@ func (r *runerT) addToken(t *nodeT) {
 }
 
 func (r *runerT) accumulate(ch rune) {
-	// Single-character tokens are directly added
-	switch ch {
-	case '/':
-		r.flush()
-		r.addString(string(ch))
-	default:
-		r.accum = append(r.accum, ch)
-	}
+	// Everything is accumulated, including paths, so multi-character
+	// tokens like "//" can be recognized when flushing.
+	r.accum = append(r.accum, ch)
 }
 
 func (r *runerT) flush() {
@@ -101,6 +112,18 @@ func (r *runerT) flush() {
 	r.accum = nil
 }
 
+// numberParams() gives each positional parameter its position,
+// in the order they appear.
+func (r *runerT) numberParams() {
+	pos := 0
+	for _, t := range r.tokens {
+		if t.Token.Symbol == paramToken && t.Text == "?" {
+			t.Text += strconv.Itoa(pos)
+			pos++
+		}
+	}
+}
+
 func (r *runerT) extractToken(s string) (*tokenT, string) {
 	var tok *tokenT
 	for k, v := range keywordMap {
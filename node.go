@@ -1,6 +1,7 @@
 package sqi
 
 import (
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -55,15 +56,43 @@ func (n *nodeT) addChild(child *nodeT) {
 }
 
 // asAst() returns the AST node for this tree node.
-func (n *nodeT) asAst() (AstNode, error) {
+func (n *nodeT) asAst(args *astArgs) (AstNode, error) {
 	// fmt.Println("ast", n.Text)
 	switch n.Token.Symbol {
-	case eqlToken, neqToken, andToken, orToken:
-		lhs, rhs, err := n.makeBinary()
+	case eqlToken, neqToken, ltToken, lteToken, gtToken, gteToken, andToken, orToken, addToken, divToken, modToken:
+		lhs, rhs, err := n.makeBinary(args)
 		if err != nil {
 			return nil, err
 		}
 		return &binaryNode{Op: n.Token.Symbol, Lhs: lhs, Rhs: rhs}, nil
+	case containsToken, startsWithToken, endsWithToken:
+		lhs, rhs, err := n.makeBinary(args)
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{Op: n.Token.Symbol, Lhs: lhs, Rhs: rhs}, nil
+	case matchToken:
+		return n.makeMatch(args)
+	case inToken:
+		return n.makeIn(args)
+	case listToken:
+		return n.makeList(args)
+	case objectToken:
+		return n.makeObject(args)
+	case orderByToken:
+		return n.makeOrder(args)
+	case limitToken, offsetToken:
+		return n.makeLimit(args)
+	case assignToken:
+		lhs, rhs, err := n.makeBinary(args)
+		if err != nil {
+			return nil, err
+		}
+		a, ok := lhs.(assigner)
+		if !ok {
+			return nil, newParseError("can't assign to " + n.Children[0].Text)
+		}
+		return &assignNode{Lhs: a, Rhs: rhs}, nil
 	case floatToken:
 		if len(n.Children) != 0 {
 			return nil, newParseError("float has wrong number of children: " + strconv.Itoa(len(n.Children)))
@@ -82,16 +111,52 @@ func (n *nodeT) asAst() (AstNode, error) {
 			return nil, err
 		}
 		return &constantNode{Value: int(i)}, nil
+	case negToken:
+		// Negate or subtract
+		if len(n.Children) == 2 {
+			lhs, rhs, err := n.makeBinary(args)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{Op: negToken, Lhs: lhs, Rhs: rhs}, nil
+		}
+		return n.makeNeg(args)
+	case notToken:
+		return n.makeNot(args)
 	case openToken:
-		child, err := n.makeUnary()
+		child, err := n.makeUnary(args)
 		if err != nil {
 			return nil, err
 		}
 		return &unaryNode{Op: openToken, Child: child}, nil
 	case openArrayToken:
-		return n.makeArray()
+		return n.makeArray(args)
+	case paramToken:
+		return n.makeParam()
+	case scopeToken:
+		if len(n.Children) != 0 || (n.Text != scopeKeyText && n.Text != scopeValueText) {
+			return nil, newParseError("unknown pseudo-field " + n.Text)
+		}
+		return &scopeNode{Key: n.Text == scopeKeyText}, nil
 	case pathToken:
-		return n.makePath()
+		return n.makePath(args)
+	case descendToken:
+		return n.makeDescend(args)
+	case callToken:
+		return n.makeCall(args)
+	case starToken:
+		// Wildcard or multiply
+		if len(n.Children) == 2 {
+			lhs, rhs, err := n.makeBinary(args)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{Op: starToken, Lhs: lhs, Rhs: rhs}, nil
+		}
+		if len(n.Children) != 0 {
+			return nil, newParseError("wildcard has wrong number of children: " + strconv.Itoa(len(n.Children)))
+		}
+		return &wildcardNode{}, nil
 	case stringToken:
 		if len(n.Children) != 0 {
 			return nil, newParseError("string has wrong number of children: " + strconv.Itoa(len(n.Children)))
@@ -100,7 +165,7 @@ func (n *nodeT) asAst() (AstNode, error) {
 		text := strings.Trim(n.Text, `"`)
 		return &constantNode{Value: text}, nil
 	case selectToken:
-		child, err := n.makeUnary()
+		child, err := n.makeUnary(args)
 		if err != nil {
 			return nil, err
 		}
@@ -109,29 +174,29 @@ func (n *nodeT) asAst() (AstNode, error) {
 	return nil, newParseError("on unknown token: " + strconv.Itoa(int(n.Token.Symbol)) + ", " + n.Token.Text)
 }
 
-func (n *nodeT) makeBinary() (AstNode, AstNode, error) {
+func (n *nodeT) makeBinary(args *astArgs) (AstNode, AstNode, error) {
 	if len(n.Children) != 2 {
 		return nil, nil, newParseError("binary has wrong number of children: " + strconv.Itoa(len(n.Children)))
 	}
-	lhs, err := n.Children[0].asAst()
+	lhs, err := n.Children[0].asAst(args)
 	if err != nil {
 		return nil, nil, err
 	}
-	rhs, err := n.Children[1].asAst()
+	rhs, err := n.Children[1].asAst(args)
 	if err != nil {
 		return nil, nil, err
 	}
 	return lhs, rhs, nil
 }
 
-func (n *nodeT) makeUnary() (AstNode, error) {
+func (n *nodeT) makeUnary(args *astArgs) (AstNode, error) {
 	if len(n.Children) != 1 {
 		return nil, newParseError("unary has wrong number of children: " + strconv.Itoa(len(n.Children)))
 	}
-	return n.Children[0].asAst()
+	return n.Children[0].asAst(args)
 }
 
-func (n *nodeT) makeArray() (AstNode, error) {
+func (n *nodeT) makeArray(args *astArgs) (AstNode, error) {
 	// A single child is a special case -- it indicates we're at the top of the tree,
 	// and we'll operate on whatever input I receive, instead of processing a lhs.
 	var lhs AstNode
@@ -142,7 +207,7 @@ func (n *nodeT) makeArray() (AstNode, error) {
 	case 1:
 		childidx = 0
 	case 2:
-		lhs, err = n.Children[0].asAst()
+		lhs, err = n.Children[0].asAst(args)
 		if err != nil {
 			return nil, err
 		}
@@ -151,6 +216,17 @@ func (n *nodeT) makeArray() (AstNode, error) {
 		return nil, newParseError("array has wrong number of children: " + strconv.Itoa(len(n.Children)))
 	}
 
+	if n.Children[childidx].Token.Symbol == sliceToken {
+		return n.makeSlice(lhs, n.Children[childidx])
+	}
+	// A string index is a key, the same as a path step: /a["b"] is /a/b.
+	if child := n.Children[childidx]; child.Token.Symbol == stringToken && len(child.Children) == 0 {
+		field := &fieldNode{Field: strings.Trim(child.Text, `"`)}
+		if lhs == nil {
+			return field, nil
+		}
+		return &pathNode{Child: lhs, Field: field}, nil
+	}
 	params, err := n.makeArrayParams(childidx)
 	if err != nil {
 		return nil, err
@@ -163,18 +239,255 @@ func (n *nodeT) makeArrayParams(childidx int) (int, error) {
 	if childidx < 0 || childidx >= len(n.Children) {
 		return 0, newParseError("array has missing child at " + strconv.Itoa(childidx))
 	}
-	child := n.Children[childidx]
-	if child.Token.Symbol != intToken {
+	index, ok, err := n.Children[childidx].asInt()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
 		return 0, newParseError("array must have int")
 	}
-	index, err := strconv.ParseInt(child.Text, 0, 32)
+	return index, nil
+}
+
+// makeSlice constructs a slice node from the lhs and the slice params.
+func (n *nodeT) makeSlice(lhs AstNode, slice *nodeT) (AstNode, error) {
+	if len(slice.Children) != 3 {
+		return nil, newParseError("slice has wrong number of children: " + strconv.Itoa(len(slice.Children)))
+	}
+	var bounds [3]*int
+	for i, child := range slice.Children {
+		if child.Token.Symbol == emptyToken {
+			continue
+		}
+		v, ok, err := child.asInt()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, newParseError("slice must have int")
+		}
+		bounds[i] = &v
+	}
+	step := 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step == 0 {
+		return nil, newParseError("slice step must not be zero")
+	}
+	return &sliceNode{Lhs: lhs, Start: bounds[0], End: bounds[1], Step: step}, nil
+}
+
+// makeNeg constructs a negation. Number constants are negated directly.
+func (n *nodeT) makeNeg(args *astArgs) (AstNode, error) {
+	if len(n.Children) != 1 {
+		return nil, newParseError("negation has wrong number of children: " + strconv.Itoa(len(n.Children)))
+	}
+	child := n.Children[0]
+	switch child.Token.Symbol {
+	case intToken, floatToken:
+		neg := newNode(child.Token.Symbol, "-"+child.Text)
+		return neg.asAst(args)
+	}
+	c, err := child.asAst(args)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return int(index), nil
+	return &unaryNode{Op: negToken, Child: c}, nil
 }
 
-func (n *nodeT) makePath() (AstNode, error) {
+// makeIn constructs a membership test. A single index on the
+// right, such as [1], is treated as a list of one item.
+func (n *nodeT) makeIn(args *astArgs) (AstNode, error) {
+	if len(n.Children) == 2 {
+		rhs := n.Children[1]
+		if rhs.Token.Symbol == openArrayToken && len(rhs.Children) == 1 && rhs.Children[0].Token.Symbol != sliceToken {
+			list := newNode(listToken, "")
+			list.addChild(rhs.Children[0])
+			n.Children[1] = list
+		}
+	}
+	lhs, rhs, err := n.makeBinary(args)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{Op: inToken, Lhs: lhs, Rhs: rhs}, nil
+}
+
+// makeList constructs a list literal. A list of constants is itself a constant.
+func (n *nodeT) makeList(args *astArgs) (AstNode, error) {
+	items := make([]AstNode, 0, len(n.Children))
+	values := make([]interface{}, 0, len(n.Children))
+	for _, child := range n.Children {
+		item, err := child.asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if c, ok := item.(*constantNode); ok && values != nil {
+			values = append(values, c.Value)
+		} else {
+			values = nil
+		}
+	}
+	if values != nil {
+		return &constantNode{Value: values}, nil
+	}
+	return &listNode{Items: items}, nil
+}
+
+// makeObject constructs an object literal from its key/value pairs.
+func (n *nodeT) makeObject(args *astArgs) (AstNode, error) {
+	obj := &objectNode{}
+	for _, pair := range n.Children {
+		if pair.Token.Symbol != colonToken || len(pair.Children) != 2 {
+			return nil, newParseError("object must have key/value pairs")
+		}
+		key := strings.Trim(pair.Children[0].Text, `"`)
+		for _, k := range obj.Keys {
+			if k == key {
+				return nil, newParseError("object has duplicate key " + key)
+			}
+		}
+		value, err := pair.Children[1].asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		obj.Keys = append(obj.Keys, key)
+		obj.Values = append(obj.Values, value)
+	}
+	return obj, nil
+}
+
+// makeOrder constructs an ordering from the lhs followed by key/direction pairs.
+func (n *nodeT) makeOrder(args *astArgs) (AstNode, error) {
+	if len(n.Children) < 3 || len(n.Children)%2 != 1 {
+		return nil, newParseError("order has wrong number of children: " + strconv.Itoa(len(n.Children)))
+	}
+	lhs, err := n.Children[0].asAst(args)
+	if err != nil {
+		return nil, err
+	}
+	order := &orderNode{Lhs: lhs}
+	for i := 1; i < len(n.Children); i += 2 {
+		key, err := n.Children[i].asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		order.Keys = append(order.Keys, key)
+		order.Desc = append(order.Desc, n.Children[i+1].Text == descText)
+	}
+	return order, nil
+}
+
+// makeLimit constructs a limit from a limit, an offset, or both in either
+// order. The offset is always applied first.
+func (n *nodeT) makeLimit(args *astArgs) (AstNode, error) {
+	limit := &limitNode{}
+	node := n
+	for node.Token.any(limitToken, offsetToken) {
+		if len(node.Children) != 2 {
+			return nil, newParseError(node.Text + " has wrong number of children: " + strconv.Itoa(len(node.Children)))
+		}
+		field := &limit.Count
+		if node.Token.Symbol == offsetToken {
+			field = &limit.Offset
+		}
+		// A repeated clause applies to the result of everything before it.
+		if *field != nil {
+			break
+		}
+		value, err := node.Children[1].asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+		node = node.Children[0]
+	}
+	lhs, err := node.asAst(args)
+	if err != nil {
+		return nil, err
+	}
+	limit.Lhs = lhs
+	return limit, nil
+}
+
+// makeMatch constructs a regular expression match. A constant pattern
+// is compiled now, so an invalid pattern is a parse error.
+func (n *nodeT) makeMatch(args *astArgs) (AstNode, error) {
+	lhs, rhs, err := n.makeBinary(args)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := rhs.(*constantNode); ok {
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return nil, newParseError("match must have string pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, newWrappedError(parseErrCode, "pattern "+pattern, err)
+		}
+		rhs = &constantNode{Value: re}
+	}
+	return &binaryNode{Op: matchToken, Lhs: lhs, Rhs: rhs}, nil
+}
+
+// makeNot constructs a logical not. Constant operands must be boolean.
+func (n *nodeT) makeNot(args *astArgs) (AstNode, error) {
+	child, err := n.makeUnary(args)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := child.(*constantNode); ok {
+		if _, ok := c.Value.(bool); !ok {
+			return nil, newParseError("not must have boolean")
+		}
+	}
+	return &unaryNode{Op: notToken, Child: child}, nil
+}
+
+// asInt() answers the value of an int constant, including negated ints.
+// The bool is false if I am not an int.
+func (n *nodeT) asInt() (int, bool, error) {
+	text := n.Text
+	switch n.Token.Symbol {
+	case intToken:
+	case negToken:
+		if len(n.Children) != 1 || n.Children[0].Token.Symbol != intToken {
+			return 0, false, nil
+		}
+		text = "-" + n.Children[0].Text
+	default:
+		return 0, false, nil
+	}
+	i, err := strconv.ParseInt(text, 0, 32)
+	if err != nil {
+		return 0, false, err
+	}
+	return int(i), true, nil
+}
+
+func (n *nodeT) makeParam() (AstNode, error) {
+	if len(n.Children) != 0 {
+		return nil, newParseError("param has wrong number of children: " + strconv.Itoa(len(n.Children)))
+	}
+	// Positional params were numbered by the lexer.
+	if strings.HasPrefix(n.Text, "?") {
+		pos, err := strconv.Atoi(n.Text[1:])
+		if err != nil {
+			return nil, newParseError("param has no position")
+		}
+		return &paramNode{Index: pos}, nil
+	}
+	name := strings.TrimPrefix(n.Text, "$")
+	if name == "" {
+		return nil, newParseError("param must have name")
+	}
+	return &paramNode{Name: name}, nil
+}
+
+func (n *nodeT) makePath(args *astArgs) (AstNode, error) {
 	// A path can have one or two children. If there are two, the first
 	// must be a path and the second must be a string. If there is
 	// one, the first must be a string.
@@ -186,7 +499,25 @@ func (n *nodeT) makePath() (AstNode, error) {
 			child0 = child0.Children[0]
 		}
 		// Validate
-		if child0.Token.Symbol != stringToken {
+		if child0.Token.Symbol == starToken {
+			return &pathNode{Field: &wildcardNode{}}, nil
+		}
+		if child0.Token.Symbol == objectToken {
+			obj, err := child0.makeObject(args)
+			if err != nil {
+				return nil, err
+			}
+			return &pathNode{Field: &eachNode{Child: obj}}, nil
+		}
+		if child0.Token.Symbol == selectToken {
+			sel, err := child0.asAst(args)
+			if err != nil {
+				return nil, err
+			}
+			return &pathNode{Field: sel}, nil
+		}
+		// Ints name map keys, i.e. /3 on a map[int]T.
+		if !child0.Token.any(stringToken, intToken) {
 			return nil, newParseError("path must have string instead of " + child0.Token.Text)
 		}
 		text := strings.Trim(child0.Text, `"`)
@@ -200,17 +531,24 @@ func (n *nodeT) makePath() (AstNode, error) {
 		}
 		// If we end in a string, we need to wrap
 		var child1Ast AstNode
-		if child1.Token.Symbol == stringToken {
+		if child1.Token.any(stringToken, intToken) {
 			text := strings.Trim(child1.Text, `"`)
 			child1Ast = &fieldNode{Field: text}
+		} else if child1.Token.Symbol == objectToken {
+			// Objects in a path are built for each item
+			obj, err := child1.makeObject(args)
+			if err != nil {
+				return nil, err
+			}
+			child1Ast = &eachNode{Child: obj}
 		} else {
-			c1n, err := child1.asAst()
+			c1n, err := child1.asAst(args)
 			if err != nil {
 				return nil, err
 			}
 			child1Ast = c1n
 		}
-		cn, err := child0.asAst()
+		cn, err := child0.asAst(args)
 		if err != nil {
 			return nil, err
 		}
@@ -219,3 +557,68 @@ func (n *nodeT) makePath() (AstNode, error) {
 		return nil, newParseError("path has wrong number of children: " + strconv.Itoa(len(n.Children)))
 	}
 }
+
+func (n *nodeT) makeCall(args *astArgs) (AstNode, error) {
+	fn := args.findFunc(n.Text)
+	if fn == nil {
+		return nil, newParseError("unknown function " + n.Text)
+	}
+	params := make([]AstNode, 0, len(n.Children))
+	for _, c := range n.Children {
+		param, err := c.asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+	}
+	err := fn.check(params)
+	if err != nil {
+		return nil, err
+	}
+	return &callNode{Fn: fn, Args: params}, nil
+}
+
+func (n *nodeT) makeDescend(args *astArgs) (AstNode, error) {
+	// A descend has the same structure as a path, but the
+	// final child must be a string or wildcard.
+	var child AstNode
+	var step *nodeT
+	switch len(n.Children) {
+	case 1:
+		step = n.Children[0]
+	case 2:
+		var err error
+		child, err = n.Children[0].asAst(args)
+		if err != nil {
+			return nil, err
+		}
+		step = n.Children[1]
+	default:
+		return nil, newParseError("descend has wrong number of children: " + strconv.Itoa(len(n.Children)))
+	}
+	switch step.Token.Symbol {
+	case stringToken:
+		text := strings.Trim(step.Text, `"`)
+		return &descendNode{Child: child, Field: text}, nil
+	case starToken:
+		return &descendNode{Child: child, Any: true}, nil
+	}
+	return nil, newParseError("descend must have string or wildcard instead of " + step.Token.Text)
+}
+
+// ------------------------------------------------------------
+// AST-ARGS
+
+type astArgs struct {
+	funcs *Funcs // Optional -- searched before the global funcs
+}
+
+// findFunc() answers the function with the given name, or nil.
+func (a *astArgs) findFunc(name string) *funcT {
+	if a != nil && a.funcs != nil {
+		if fn := a.funcs.find(name); fn != nil {
+			return fn
+		}
+	}
+	return globalFuncs.find(name)
+}
@@ -3,11 +3,13 @@ package sqi
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -33,7 +35,28 @@ func TestLexer(t *testing.T) {
 		{`([1]) == "b"`, tokens(`(`, `[`, 1, `]`, `)`, `==`, `"b"`), nil},
 		{`/a[0]`, tokens(`/`, `a`, `[`, 0, `]`), nil},
 		{`/a[0]/b`, tokens(`/`, `a`, `[`, 0, `]`, `/`, `b`), nil},
-		//		{`/a[ -1]`, tokens(`/`, `a`, `[`, 0, `]`), nil},
+		{`//a`, tokens(`//`, `a`), nil},
+		{`/a//b`, tokens(`/`, `a`, `//`, `b`), nil},
+		{`/a/*`, tokens(`/`, `a`, `/`, `*`), nil},
+		{`len(/a)`, tokens(`len`, `(`, `/`, `a`, `)`), nil},
+		{`f(a,"b")`, tokens(`f`, `(`, `a`, `,`, `"b"`, `)`), nil},
+		{`/a == $b`, tokens(`/`, `a`, `==`, paramN(`$b`)), nil},
+		{`/a==? || /b==?`, tokens(`/`, `a`, `==`, paramN(`?0`), `||`, `/`, `b`, `==`, paramN(`?1`)), nil},
+		{`a<=10`, tokens(`a`, `<=`, 10), nil},
+		{`a >= 10 && b<c`, tokens(`a`, `>=`, 10, `&&`, `b`, `<`, `c`), nil},
+		{`/a[ -1]`, tokens(`/`, `a`, `[`, `-`, 1, `]`), nil},
+		{`/a[1:3]`, tokens(`/`, `a`, `[`, 1, `:`, 3, `]`), nil},
+		{`/a[:-2]`, tokens(`/`, `a`, `[`, `:`, `-`, 2, `]`), nil},
+		{`!(a)`, tokens(`!`, `(`, `a`, `)`), nil},
+		{`a!=!b`, tokens(`a`, `!=`, `!`, `b`), nil},
+		{`/a=~"^b"`, tokens(`/`, `a`, `=~`, `"^b"`), nil},
+		{`/a contains "b"`, tokens(`/`, `a`, `contains`, `"b"`), nil},
+		{`/a in ["b",1]`, tokens(`/`, `a`, `in`, `[`, `"b"`, `,`, 1, `]`), nil},
+		{`{a:/b, c: 1}`, tokens(`{`, `a`, `:`, `/`, `b`, `,`, `c`, `:`, 1, `}`), nil},
+		{`/a orderBy /b desc, /c limit 5 offset 2`, tokens(`/`, `a`, `orderBy`, `/`, `b`, `desc`, `,`, `/`, `c`, `limit`, 5, `offset`, 2), nil},
+		{`/a/(@key == "b")`, tokens(`/`, `a`, `/`, `(`, newNode(scopeToken, `@key`), `==`, `"b"`, `)`), nil},
+		{`/a+1`, tokens(`/`, `a`, `+`, 1), nil},
+		{`/a * /b div 2 % 3`, tokens(`/`, `a`, `*`, `/`, `b`, `div`, 2, `%`, 3), nil},
 	}
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
@@ -68,6 +91,29 @@ func TestParser(t *testing.T) {
 	want13 := pathN(arrayN(pathN(strN(`a`), nil), intN(0)), strN(`b`))
 	want14 := arrayN(pathN(pathN(strN(`a`), nil), strN(`b`)), intN(0))
 	want15 := pathN(pathN(strN(`a`), nil), eqlN(pathN(strN(`b`), nil), strN(`c`)))
+	want17 := arrayN(pathN(strN(`a`), nil), negN(intN(1)))
+	want18 := arrayN(pathN(strN(`a`), nil), sliceN(intN(1), intN(3), nil))
+	want19 := arrayN(pathN(strN(`a`), nil), sliceN(nil, nil, negN(intN(2))))
+	want20 := descN(strN(`a`), nil)
+	want21 := descN(pathN(strN(`a`), nil), strN(`b`))
+	want22 := pathN(pathN(strN(`a`), nil), newNode(starToken, `*`))
+	want23 := callN(`len`, pathN(strN(`a`), nil))
+	want24 := eqlN(callN(`f`, strN(`a`), intN(1)), strN(`b`))
+	want25 := callN(`f`)
+	want26 := pathN(callN(`f`), strN(`a`))
+	want27 := binN(addToken, pathN(strN(`a`), nil), binN(starToken, intN(1), intN(2)))
+	want28 := eqlN(binN(negToken, binN(addToken, intN(1), intN(2)), intN(3)), negN(pathN(strN(`a`), nil)))
+	want29 := binN(assignToken, pathN(strN(`a`), nil), binN(addToken, pathN(strN(`b`), nil), intN(1)))
+	want30 := notN(orN(eqlN(pathN(strN(`a`), nil), strN(`b`)), eqlN(pathN(strN(`a`), nil), strN(`c`))))
+	want31 := eqlN(notN(pathN(strN(`a`), nil)), strN(`b`))
+	want32 := binN(inToken, pathN(strN(`a`), nil), listN(strN(`b`), intN(1)))
+	want33 := listN(intN(1))
+	want34 := binN(inToken, strN(`b`), pathN(strN(`a`), nil))
+	want35 := objN(pairN(`a`, pathN(strN(`b`), nil)), pairN(`c`, intN(1)))
+	want36 := pathN(pathN(strN(`a`), nil), objN(pairN(`in`, pathN(strN(`b`), nil))))
+	want37 := binN(offsetToken, binN(limitToken, orderN(pathN(strN(`a`), nil), pathN(strN(`b`), nil), `desc`, pathN(strN(`c`), nil), `asc`), intN(5)), intN(2))
+	want38 := orderN(pathN(pathN(strN(`a`), nil), eqlN(pathN(strN(`b`), nil), intN(1))), pathN(strN(`c`), nil), `asc`)
+	want16 := andN(binN(gteToken, pathN(strN(`a`), nil), intN(1)), binN(ltToken, pathN(strN(`b`), nil), intN(2)))
 
 	cases := []struct {
 		Input    []*nodeT
@@ -91,8 +137,47 @@ func TestParser(t *testing.T) {
 		{tokens(`/`, `a`, `[`, 0, `]`, `/`, `b`), want13, nil},
 		{tokens(`/`, `a`, `/`, `b`, `[`, 0, `]`), want14, nil},
 		{tokens(`/`, `a`, `/`, `(`, `/`, `b`, `==`, `c`, `)`), want15, nil},
+		{tokens(`/`, `a`, `>=`, 1, `&&`, `/`, `b`, `<`, 2), want16, nil},
+		{tokens(`/`, `a`, `[`, `-`, 1, `]`), want17, nil},
+		{tokens(`/`, `a`, `[`, 1, `:`, 3, `]`), want18, nil},
+		{tokens(`/`, `a`, `[`, `:`, `:`, `-`, 2, `]`), want19, nil},
+		{tokens(`//`, `a`), want20, nil},
+		{tokens(`/`, `a`, `//`, `b`), want21, nil},
+		{tokens(`/`, `a`, `/`, `*`), want22, nil},
+		{tokens(`len`, `(`, `/`, `a`, `)`), want23, nil},
+		{tokens(`f`, `(`, `a`, `,`, 1, `)`, `==`, `b`), want24, nil},
+		{tokens(`f`, `(`, `)`), want25, nil},
+		{tokens(`f`, `(`, `)`, `/`, `a`), want26, nil},
+		{tokens(`/`, `a`, `+`, 1, `*`, 2), want27, nil},
+		{tokens(1, `+`, 2, `-`, 3, `==`, `-`, `/`, `a`), want28, nil},
+		{tokens(`/`, `a`, `=`, `/`, `b`, `+`, 1), want29, nil},
+		{tokens(`!`, `(`, `/`, `a`, `==`, `b`, `||`, `/`, `a`, `==`, `c`, `)`), want30, nil},
+		{tokens(`!`, `/`, `a`, `==`, `b`), want31, nil},
+		{tokens(`/`, `a`, `in`, `[`, `b`, `,`, 1, `]`), want32, nil},
+		{tokens(`[`, 1, `,`, `]`), want33, nil},
+		{tokens(`b`, `in`, `/`, `a`), want34, nil},
+		{tokens(`{`, `a`, `:`, `/`, `b`, `,`, `c`, `:`, 1, `}`), want35, nil},
+		{tokens(`/`, `a`, `/`, `{`, `in`, `:`, `/`, `b`, `,`, `}`), want36, nil},
+		{tokens(`/`, `a`, `orderBy`, `/`, `b`, `desc`, `,`, `/`, `c`, `limit`, 5, `offset`, 2), want37, nil},
+		{tokens(`/`, `a`, `/`, `(`, `/`, `b`, `==`, 1, `)`, `orderBy`, `/`, `c`), want38, nil},
 		// Errors
 		{tokens(`(`, `a`, `[`, 0, `]`), nil, parseErr},
+		{tokens(`/`, `a`, `orderBy`), nil, parseErr},
+		{tokens(`{`, `a`, 1, `}`), nil, parseErr},
+		{tokens(`{`, 1, `:`, 2, `}`), nil, parseErr},
+		{tokens(`{`, `a`, `:`, 1), nil, parseErr},
+		{tokens(`{`, `a`, `:`, 1, `b`, `}`), nil, parseErr},
+		{tokens(`[`, 1, `,`, `,`, 2, `]`), nil, parseErr},
+		{tokens(`[`, 1, `,`, 2, `:`, `]`), nil, parseErr},
+		{tokens(`[`, 1, `:`, 2, `,`, `]`), nil, parseErr},
+		{tokens(`/`, `a`, `[`, 1, `,`, 2, `]`), nil, parseErr},
+		{tokens(`/`, `a`, `[`, 0), nil, parseErr},
+		{tokens(`/`, `a`, `[`, `]`), nil, parseErr},
+		{tokens(`/`, `a`, `[`, 1, `:`, 2, `:`, 3, `:`, 4, `]`), nil, parseErr},
+		{tokens(`f`, `(`, `a`), nil, parseErr},
+		{tokens(`f`, `(`, `a`, `b`, `)`), nil, parseErr},
+		{tokens(`"a"`, `(`, `)`), nil, parseErr},
+		{tokens(`/`, `a`, `/`, `b`, `(`, `)`), nil, parseErr},
 	}
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
@@ -114,6 +199,12 @@ func TestParser(t *testing.T) {
 func TestContextualizer(t *testing.T) {
 	input0 := pathN(pathN(strN(`a`), nil), eqlN(pathN(strN(`b`), nil), strN(`c`)))
 	want0 := pathN(pathN(strN(`a`), nil), selN(eqlN(pathN(strN(`b`), nil), strN(`c`))))
+	input1 := pathN(pathN(strN(`a`), nil), binN(gtToken, pathN(strN(`b`), nil), intN(1)))
+	want1 := pathN(pathN(strN(`a`), nil), selN(binN(gtToken, pathN(strN(`b`), nil), intN(1))))
+	input2 := pathN(pathN(strN(`a`), nil), notN(eqlN(pathN(strN(`b`), nil), strN(`c`))))
+	want2 := pathN(pathN(strN(`a`), nil), selN(notN(eqlN(pathN(strN(`b`), nil), strN(`c`)))))
+	input3 := pathN(pathN(strN(`a`), nil), binN(andToken, binN(gtToken, pathN(strN(`b`), nil), intN(1)), binN(ltToken, pathN(strN(`b`), nil), intN(9))))
+	want3 := pathN(pathN(strN(`a`), nil), selN(binN(andToken, binN(gtToken, pathN(strN(`b`), nil), intN(1)), binN(ltToken, pathN(strN(`b`), nil), intN(9)))))
 
 	cases := []struct {
 		Input    *nodeT
@@ -122,6 +213,12 @@ func TestContextualizer(t *testing.T) {
 	}{
 		// A select
 		{input0, want0, nil},
+		// A select from an ordering
+		{input1, want1, nil},
+		// A select from a negation
+		{input2, want2, nil},
+		// A select from a range
+		{input3, want3, nil},
 	}
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
@@ -148,6 +245,18 @@ func TestExpr(t *testing.T) {
 	input4 := &Person{Age: 22}
 	input5 := &Person{Name: "Ana", Age: 22}
 	input6 := &Person{Children: []Person{Person{Name: "a"}, Person{Name: "b"}, Person{Name: "c"}}}
+	input7 := &Person{Children: []Person{Person{Name: "a", Age: 12}, Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}}
+	input8 := map[string]interface{}{"Items": map[string]interface{}{"b": 2, "a": 1, "c": 3}}
+	input10 := map[string]interface{}{"Items": map[string]interface{}{"x": map[string]interface{}{"Age": 3}, "y": map[string]interface{}{"Age": 5}}}
+	input11 := &Person{Children: []Person{Person{Name: "a", Age: 5}, Person{Name: "b", Age: 3}, Person{Name: "c", Age: 5}, Person{Name: "d", Age: 1}}}
+	input13 := map[string]interface{}{"Users": map[string]Person{"ana": Person{Name: "Ana", Age: 22}, "bob": Person{Name: "Bob", Age: 3}}, "Ages": map[string]int{"a": 20, "b": 10}}
+	input14 := &Person{Children: []Person{Person{Name: "a", Children: []Person{Person{Name: "a1"}, Person{Name: "a2"}}}, Person{Name: "b"}, Person{Name: "c", Children: []Person{Person{Name: "c1"}}}}}
+	input15 := &Account{FirstName: "Ana", Password: "x", Nick: "A", Address: Address{City: "Oslo"}, Friends: []Account{Account{FirstName: "b"}, Account{FirstName: "c"}}}
+	input12 := &Person{Children: []Person{Person{Name: "a", Age: 1}, Person{Name: "b", Age: 2}, Person{Name: "a", Age: 1}}}
+	input9 := map[string]interface{}{
+		"a": map[string]interface{}{"Name": "x", "Age": 10},
+		"b": []interface{}{map[string]interface{}{"Name": "y", "Kids": []interface{}{map[string]interface{}{"Name": "z"}}}},
+	}
 
 	cases := []struct {
 		ExprInput string
@@ -179,6 +288,17 @@ func TestExpr(t *testing.T) {
 		{`(/Name == "Mana") || (/Age == 23)`, input5, Opt{}, false, nil},
 		// Path equality
 		{`/Mom/Name == /Mom/Name`, input1, Opt{}, true, nil},
+		// Ordering
+		{`/Age < 23`, input4, Opt{}, true, nil},
+		{`/Age <= 22`, input4, Opt{}, true, nil},
+		{`/Age > 22`, input4, Opt{}, false, nil},
+		{`/Age >= 22.0`, input4, Opt{}, true, nil},
+		{`/Name < "Bob"`, input3, Opt{}, true, nil},
+		{`/Name > "Bob"`, input3, Opt{}, false, nil},
+		{`/Name > 22`, input3, Opt{Strict: false}, false, nil},
+		{`/Name > 22`, input3, Opt{Strict: true}, false, mismatchErr},
+		{`/Children/(/Age >= 18)`, input7, Opt{}, []Person{Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}, nil},
+		{`/Children/(/Age < 18)`, input7, Opt{}, []Person{Person{Name: "a", Age: 12}}, nil},
 		// Select
 		{`/Children/(/Name == "c")`, input6, Opt{}, []Person{Person{Name: "c"}}, nil},
 		// Select, unwinding the results to a single item
@@ -190,8 +310,181 @@ func TestExpr(t *testing.T) {
 		{`[1]`, [2]string{"a", "b"}, Opt{}, "b", nil},
 		{`([1]) == "b"`, [2]string{"a", "b"}, Opt{}, true, nil},
 		{`/Children[0]`, input3, Opt{}, nil, nil},
+		{`/Children[-1]`, input6, Opt{}, Person{Name: "c"}, nil},
+		{`/Children[-3]/Name`, input6, Opt{}, "a", nil},
+		{`[-1]`, [2]string{"a", "b"}, Opt{}, "b", nil},
+		// Slices
+		{`/Children[1:3]`, input6, Opt{}, []Person{Person{Name: "b"}, Person{Name: "c"}}, nil},
+		{`/Children[:2]`, input6, Opt{}, []Person{Person{Name: "a"}, Person{Name: "b"}}, nil},
+		{`/Children[2:]`, input6, Opt{}, []Person{Person{Name: "c"}}, nil},
+		{`/Children[-2:]`, input6, Opt{}, []Person{Person{Name: "b"}, Person{Name: "c"}}, nil},
+		{`/Children[::2]`, input6, Opt{}, []Person{Person{Name: "a"}, Person{Name: "c"}}, nil},
+		{`/Children[::-1]`, input6, Opt{}, []Person{Person{Name: "c"}, Person{Name: "b"}, Person{Name: "a"}}, nil},
+		{`/Children[5:]`, input6, Opt{}, []Person{}, nil},
+		{`[0:1]`, [2]string{"a", "b"}, Opt{}, []string{"a"}, nil},
 		// Maps
 		{`/a`, map[string]string{`a`: `a1`}, Opt{}, "a1", nil},
+		// Wildcards
+		{`/Items/*`, input8, Opt{}, []int{1, 2, 3}, nil},
+		{`/Items/*[-1]`, input8, Opt{}, 3, nil},
+		{`/Items/*/(/Age > 4)`, input10, Opt{}, []map[string]interface{}{{"Age": 5}}, nil},
+		{`/Mom/*`, input0, Opt{}, []string{"Ana Belle"}, nil},
+		{`/a/*`, input9, Opt{}, []interface{}{10, "x"}, nil},
+		{`/b/*/Name`, input9, Opt{}, []string{"y"}, nil},
+		// Functions
+		{`len(/Children)`, input6, Opt{}, 3, nil},
+		{`len(/Children) > 2`, input6, Opt{}, true, nil},
+		{`len(/Name)`, input3, Opt{}, 3, nil},
+		{`lower(/Name) == "ana"`, input3, Opt{}, true, nil},
+		{`/Children/(upper(/Name) == "B")`, input6, Opt{}, []Person{Person{Name: "b"}}, nil},
+		{`len(/Age)`, input4, Opt{}, nil, evalErr},
+		// Params
+		{`/Name == $name`, input3, Opt{Params: map[string]interface{}{"name": "Ana"}}, true, nil},
+		{`/Name == $name`, input3, Opt{Params: map[string]interface{}{"name": "Bob"}}, false, nil},
+		{`/Children/(/Age >= ?)`, input7, Opt{Args: []interface{}{13}}, []Person{Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}, nil},
+		{`/Age > ? && /Age < ?`, input4, Opt{Args: []interface{}{13, 30}}, true, nil},
+		{`/Name == $name`, input3, Opt{Params: map[string]interface{}{"name": "a\" || 1"}}, false, nil},
+		{`/Name == $name`, input3, Opt{}, false, evalErr},
+		{`/Name == ?`, input3, Opt{}, false, evalErr},
+		// Descend
+		{`//Name`, input9, Opt{}, []string{"x", "y", "z"}, nil},
+		{`/b//Name`, input9, Opt{}, []string{"y", "z"}, nil},
+		{`(//Name)[1]`, input9, Opt{}, "y", nil},
+		{`//Missing`, input9, Opt{}, []interface{}{}, nil},
+		// Arithmetic
+		{`/Age + 1 == 23`, input4, Opt{}, true, nil},
+		{`/Age * 2`, input4, Opt{}, 44, nil},
+		{`/Age - 2 * 3`, input4, Opt{}, 16, nil},
+		{`(/Age - 2) * 3`, input4, Opt{}, 60, nil},
+		{`/Age div 2`, input4, Opt{}, 11, nil},
+		{`/Age % 5`, input4, Opt{}, 2, nil},
+		{`/Age + 0.5`, input4, Opt{}, 22.5, nil},
+		{`-/Age`, input4, Opt{}, -22, nil},
+		{`/Age div 0`, input4, Opt{}, nil, evalErr},
+		{`/Age % 0`, input4, Opt{}, nil, evalErr},
+		{`/Name + 1`, input3, Opt{}, nil, nil},
+		{`/Name + 1`, input3, Opt{Strict: true}, nil, mismatchErr},
+		{`/Children/(/Age * 2 > 30)`, input7, Opt{}, []Person{Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}, nil},
+		// Not
+		{`!(/Name == "a" || /Name == "b")`, input5, Opt{}, true, nil},
+		{`not (/Age > 20)`, input5, Opt{}, false, nil},
+		{`!!(/Age == 22)`, input5, Opt{}, true, nil},
+		{`/Children/!(/Age >= 18)`, input7, Opt{}, []Person{Person{Name: "a", Age: 12}}, nil},
+		{`/Children/(not (/Name == "a" || /Name == "b"))`, input7, Opt{}, []Person{Person{Name: "c", Age: 30}}, nil},
+		{`/Children/(/Age >= 18 && /Age < 30)`, input7, Opt{}, []Person{Person{Name: "b", Age: 18}}, nil},
+		{`/Children/(/Name == "a" || /Age > 20)/Name`, input7, Opt{}, []string{"a", "c"}, nil},
+		{`!/Name`, input5, Opt{}, false, conditionErr},
+		// String matching
+		{`/Name contains "n"`, input5, Opt{}, true, nil},
+		{`/Name startsWith "An"`, input5, Opt{}, true, nil},
+		{`/Name endsWith "x"`, input5, Opt{}, false, nil},
+		{`/Name =~ "^A.a$"`, input5, Opt{}, true, nil},
+		{`/Name =~ $p`, input5, Opt{Params: map[string]interface{}{"p": "^a"}}, false, nil},
+		{`/Children/(/Name =~ "^[ab]$")`, input7, Opt{}, []Person{Person{Name: "a", Age: 12}, Person{Name: "b", Age: 18}}, nil},
+		{`/Children/!(/Name startsWith "a")`, input7, Opt{}, []Person{Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}, nil},
+		{`/Age contains "2"`, input5, Opt{}, false, nil},
+		{`/Age contains "2"`, input5, Opt{Strict: true}, false, mismatchErr},
+		{`/Name =~ $p`, input5, Opt{Params: map[string]interface{}{"p": "["}}, false, evalErr},
+		{`/contains`, map[string]interface{}{"contains": "x"}, Opt{}, "x", nil},
+		// In
+		{`/Name in ["a", "Ana"]`, input5, Opt{}, true, nil},
+		{`/Name in ["a", "b",]`, input5, Opt{}, false, nil},
+		{`/Age in [1, 22.0]`, input5, Opt{}, true, nil},
+		{`/Age in [22]`, input5, Opt{}, true, nil},
+		{`/Age in ["a", 22]`, input5, Opt{}, true, nil},
+		{`/Age in ["a", 22]`, input5, Opt{Strict: true}, false, mismatchErr},
+		{`/Name in [lower(/Name), "b"]`, input5, Opt{}, false, nil},
+		{`/Name in [/Name, "b"]`, input5, Opt{}, true, nil},
+		{`/Children/(/Name in ["a", "c"])`, input7, Opt{}, []Person{Person{Name: "a", Age: 12}, Person{Name: "c", Age: 30}}, nil},
+		{`"admin" in /Roles`, map[string]interface{}{"Roles": []string{"user", "admin"}}, Opt{}, true, nil},
+		{`"admin" in /Name`, input5, Opt{}, false, nil},
+		{`"admin" in /Name`, input5, Opt{Strict: true}, false, mismatchErr},
+		{`/Users/("admin" in /Roles)`, map[string]interface{}{"Users": []map[string]interface{}{{"Name": "a", "Roles": []string{"admin"}}, {"Name": "b"}}}, Opt{}, []map[string]interface{}{{"Name": "a", "Roles": []string{"admin"}}}, nil},
+		// Objects
+		{`{name: /Name, age: /Age}`, input5, Opt{}, map[string]interface{}{"name": "Ana", "age": 22}, nil},
+		{`{"first name": /Name, adult: /Age >= 18}`, input5, Opt{}, map[string]interface{}{"first name": "Ana", "adult": true}, nil},
+		{`{}`, input5, Opt{}, map[string]interface{}{}, nil},
+		{`/Mom/{n: /Name}`, input0, Opt{}, map[string]interface{}{"n": "Ana Belle"}, nil},
+		{`/Children/{n: /Name}`, input7, Opt{}, []map[string]interface{}{{"n": "a"}, {"n": "b"}, {"n": "c"}}, nil},
+		{`/Children/(/Age >= 18)/{n: /Name, a: /Age}`, input7, Opt{}, []map[string]interface{}{{"n": "b", "a": 18}, {"n": "c", "a": 30}}, nil},
+		{`{old: /Children/(/Age >= 18)/{n: /Name}}`, input7, Opt{}, map[string]interface{}{"old": []map[string]interface{}{{"n": "b"}, {"n": "c"}}}, nil},
+		{`/Children/(/Age > 100)/{n: /Name}`, input7, Opt{}, []interface{}{}, nil},
+		// Aggregates
+		{`count(/Children)`, input7, Opt{}, 3, nil},
+		{`count(/Children/(/Age >= 18))`, input7, Opt{}, 2, nil},
+		{`count(/Children, /Age >= 18)`, input7, Opt{}, 2, nil},
+		{`sum(/Children, /Age)`, input7, Opt{}, 60, nil},
+		{`sum(/Children, /Age) > 50`, input7, Opt{}, true, nil},
+		{`sum([1, 2.5, 3])`, input7, Opt{}, 6.5, nil},
+		{`avg(/Children, /Age)`, input7, Opt{}, 20, nil},
+		{`min(/Children, /Age)`, input7, Opt{}, 12, nil},
+		{`max(/Children, /Age)`, input7, Opt{}, 30, nil},
+		{`max(/Children, /Name)`, input7, Opt{}, "c", nil},
+		{`count(/Children/(/Age > 100))`, input7, Opt{}, 0, nil},
+		{`sum(/Children/(/Age > 100), /Age)`, input7, Opt{}, 0, nil},
+		{`avg(/Children/(/Age > 100), /Age)`, input7, Opt{}, nil, nil},
+		{`max(/Children/(/Age > 100), /Age)`, input7, Opt{}, nil, nil},
+		{`sum(/Children, /Name)`, input7, Opt{}, nil, evalErr},
+		{`sum(/Name)`, input5, Opt{}, nil, evalErr},
+		{`sum(/Children, /Age, /Age)`, input7, Opt{}, nil, evalErr},
+		// Ordering and limiting
+		{`/Children orderBy /Age`, input11, Opt{}, []Person{Person{Name: "d", Age: 1}, Person{Name: "b", Age: 3}, Person{Name: "a", Age: 5}, Person{Name: "c", Age: 5}}, nil},
+		{`/Children orderBy /Age desc`, input11, Opt{}, []Person{Person{Name: "a", Age: 5}, Person{Name: "c", Age: 5}, Person{Name: "b", Age: 3}, Person{Name: "d", Age: 1}}, nil},
+		{`/Children orderBy /Age desc, /Name desc`, input11, Opt{}, []Person{Person{Name: "c", Age: 5}, Person{Name: "a", Age: 5}, Person{Name: "b", Age: 3}, Person{Name: "d", Age: 1}}, nil},
+		{`/Children orderBy /Age asc limit 2`, input11, Opt{}, []Person{Person{Name: "d", Age: 1}, Person{Name: "b", Age: 3}}, nil},
+		{`/Children orderBy /Age limit 2 offset 1`, input11, Opt{}, []Person{Person{Name: "b", Age: 3}, Person{Name: "a", Age: 5}}, nil},
+		{`/Children offset 1 limit 2 orderBy /Name desc`, input11, Opt{}, []Person{Person{Name: "c", Age: 5}, Person{Name: "b", Age: 3}}, nil},
+		{`/Children offset 3`, input11, Opt{}, []Person{Person{Name: "d", Age: 1}}, nil},
+		{`/Children offset 10`, input11, Opt{}, []Person{}, nil},
+		{`/Children limit $n`, input11, Opt{Params: map[string]interface{}{"n": 1}}, []Person{Person{Name: "a", Age: 5}}, nil},
+		{`/Children/(/Age > 2) orderBy /Name desc limit 1`, input11, Opt{}, []Person{Person{Name: "c", Age: 5}}, nil},
+		{`(/Children orderBy /Age)[0]/Name`, input11, Opt{}, "d", nil},
+		{`count(/Children limit 2)`, input11, Opt{}, 2, nil},
+		{`/Name orderBy /Age`, input5, Opt{}, "Ana", nil},
+		{`/Name orderBy /Age`, input5, Opt{Strict: true}, nil, evalErr},
+		{`/Children limit -1`, input11, Opt{}, nil, evalErr},
+		{`/Children limit 1.5`, input11, Opt{}, nil, evalErr},
+		// Distinct and group by
+		{`distinct(/Children, /Age)`, input11, Opt{}, []int{5, 3, 1}, nil},
+		{`count(distinct(/Children, /Age))`, input11, Opt{}, 3, nil},
+		{`distinct([1, 2.0, 1.0, "a", "a"])`, input11, Opt{}, []interface{}{1, 2.0, "a"}, nil},
+		{`distinct(/Children)`, input12, Opt{}, []Person{Person{Name: "a", Age: 1}, Person{Name: "b", Age: 2}}, nil},
+		{`distinct(/Children/(/Age > 5))`, input12, Opt{}, []Person{}, nil},
+		{`groupBy(/Children, /Name)`, input12, Opt{}, map[string][]Person{"a": []Person{Person{Name: "a", Age: 1}, Person{Name: "a", Age: 1}}, "b": []Person{Person{Name: "b", Age: 2}}}, nil},
+		{`groupBy(/Name, /Name)`, input12, Opt{}, nil, evalErr},
+		// Map selects
+		{`/Users/(/Age > 10)`, input13, Opt{}, map[string]Person{"ana": Person{Name: "Ana", Age: 22}}, nil},
+		{`/Users/(@key startsWith "b")`, input13, Opt{}, map[string]Person{"bob": Person{Name: "Bob", Age: 3}}, nil},
+		{`/Users/(@key == "x")`, input13, Opt{}, map[string]Person{}, nil},
+		{`/Ages/(@value >= 18)`, input13, Opt{}, map[string]int{"a": 20}, nil},
+		{`/Children/(@key > 0)`, input7, Opt{}, []Person{Person{Name: "b", Age: 18}, Person{Name: "c", Age: 30}}, nil},
+		{`/(@key startsWith "a")`, map[string]int{"ab": 1, "b": 2}, Opt{}, map[string]int{"ab": 1}, nil},
+		{`/(/Age > 1)`, []Person{Person{Age: 1}, Person{Age: 2}}, Opt{}, []Person{Person{Age: 2}}, nil},
+		{`@key`, input5, Opt{}, nil, nil},
+		{`@key`, input5, Opt{Strict: true}, nil, evalErr},
+		// Paths across collections
+		{`/Children/Name`, input7, Opt{}, []string{"a", "b", "c"}, nil},
+		{`/Children/(/Age >= 18)/Name`, input7, Opt{}, []string{"b", "c"}, nil},
+		{`/Children/Name[1]`, input7, Opt{}, "b", nil},
+		{`/Children/Children`, input14, Opt{}, []Person{Person{Name: "a1"}, Person{Name: "a2"}, Person{Name: "c1"}}, nil},
+		{`/Children/Children/Name`, input14, Opt{}, []string{"a1", "a2", "c1"}, nil},
+		{`/b/Kids/Name`, input9, Opt{}, []string{"z"}, nil},
+		{`"b" in /Children/Name`, input7, Opt{}, true, nil},
+		{`max(/Children/Age)`, input7, Opt{}, 30, nil},
+		// Struct tags
+		{`/first_name`, input15, Opt{Tag: "json"}, "Ana", nil},
+		{`/Nick`, input15, Opt{Tag: "json"}, "A", nil},
+		{`/city`, input15, Opt{Tag: "json"}, "Oslo", nil},
+		{`/friends/(/first_name == "b")/first_name`, input15, Opt{Tag: "json"}, []string{"b"}, nil},
+		{`//first_name`, input15, Opt{Tag: "json"}, []string{"Ana", "b", "c"}, nil},
+		// Ignore case
+		{`/name`, input5, Opt{IgnoreCase: true}, "Ana", nil},
+		{`/children/(/AGE >= 18)/name`, input7, Opt{IgnoreCase: true}, []string{"b", "c"}, nil},
+		{`/FIRST_NAME`, input15, Opt{Tag: "json", IgnoreCase: true}, "Ana", nil},
+		// Map keys that aren't strings
+		{`/Ages/3`, map[string]interface{}{"Ages": map[int]string{3: "c", 4: "d"}}, Opt{}, "c", nil},
+		{`/Ages[4]`, map[string]interface{}{"Ages": map[int]string{3: "c", 4: "d"}}, Opt{}, "d", nil},
+		{`/Ages["4"]`, map[string]interface{}{"Ages": map[int]string{3: "c", 4: "d"}}, Opt{}, "d", nil},
 		// Special paths
 		{`/a/b`, map[string]string{`a/b`: `a1`}, Opt{}, nil, nil},
 		{`/"a/b"`, map[string]string{`a/b`: `a1`}, Opt{}, "a1", nil},
@@ -205,6 +498,155 @@ func TestExpr(t *testing.T) {
 	}
 }
 
+// ------------------------------------------------------------
+// TEST-MAKE-EXPR
+
+// TestMakeExpr covers errors that are caught when compiling an expression.
+func TestMakeExpr(t *testing.T) {
+	cases := []struct {
+		ExprInput string
+		WantErr   error
+	}{
+		{`!(/a == 1)`, nil},
+		{`!"a"`, parseErr},
+		{`not 1`, parseErr},
+		{`{a: 1, b: 2,}`, nil},
+		{`{a: 1, a: 2}`, parseErr},
+		{`groupBy(/a)`, parseErr},
+		{`/a/(@foo == 1)`, parseErr},
+		{`/a =~ "^a+$"`, nil},
+		{`/a =~ "["`, parseErr},
+		{`/a =~ 1`, parseErr},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, haveErr := MakeExpr(tc.ExprInput)
+			if !errorMatches(haveErr, tc.WantErr) {
+				fmt.Println("Error mismatch, have\n", haveErr, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-STRUCT-EXPR
+
+// TestStructExpr covers expressions on data that can't round trip through json.
+func TestStructExpr(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+	cycle0 := &Node{Name: "a"}
+	cycle0.Next = &Node{Name: "b", Next: cycle0}
+	shared := &Node{Name: "s"}
+	input0 := []*Node{&Node{Name: "a", Next: shared}, &Node{Name: "b", Next: shared}}
+
+	cases := []struct {
+		ExprInput string
+		EvalInput interface{}
+		Opts      Opt
+		WantResp  interface{}
+		WantErr   error
+	}{
+		// Descend stops at cycles, but not shared references
+		{`//Name`, cycle0, Opt{}, []string{"a", "b"}, nil},
+		{`//Name`, input0, Opt{}, []string{"a", "s", "b", "s"}, nil},
+		// Without a tag, struct fields have their own names
+		{`/FirstName`, &Account{FirstName: "Ana"}, Opt{}, "Ana", nil},
+		{`/Password`, &Account{Password: "x"}, Opt{}, "x", nil},
+		{`/first_name = "b"`, &Account{FirstName: "Ana"}, Opt{Tag: "json"}, 1, nil},
+		// Numbers of any kind are compared
+		{`/Count > 3`, &Counter{Count: 5}, Opt{}, true, nil},
+		{`/Count == 5.0`, &Counter{Count: 5}, Opt{}, true, nil},
+		{`/Count > 3`, &Counter{Count: 5}, Opt{Strict: true}, false, mismatchErr},
+		{`/Size >= 200`, &Counter{Size: 200}, Opt{}, true, nil},
+		{`/Count < /Size`, &Counter{Count: -1, Size: 200}, Opt{}, true, nil},
+		{`/Kids/(/Count >= 2)/Name`, &Counter{Kids: []Counter{Counter{Name: "a", Count: 1}, Counter{Name: "b", Count: 2}}}, Opt{}, []string{"b"}, nil},
+		// Group by keeps the type of the key
+		{`groupBy(/Children, /Age)`, &Person{Children: []Person{Person{Name: "a", Age: 5}, Person{Name: "b", Age: 3}, Person{Name: "c", Age: 5}}}, Opt{},
+			map[int][]Person{5: []Person{Person{Name: "a", Age: 5}, Person{Name: "c", Age: 5}}, 3: []Person{Person{Name: "b", Age: 3}}}, nil},
+		{`(groupBy(/items, /k))/a`, jsonInput(`{"items": [{"k": "a"}, {"k": 1}, {"k": "a"}]}`), Opt{}, `[{"k":"a"},{"k":"a"}]`, nil},
+		{`(groupBy(/items, /k))/1`, jsonInput(`{"items": [{"k": "a"}, {"k": 1}, {"k": "a"}]}`), Opt{}, `[{"k":1}]`, nil},
+		{`groupBy(/items, /k)`, jsonInput(`{"items": [{"k": "a"}, {"k": ["a"]}]}`), Opt{}, nil, evalErr},
+		// Arithmetic keeps ints unless a float is involved, and strict mode won't mix
+		{`/Age div 4`, &Person{Age: 22}, Opt{}, 5, nil},
+		{`/Age div 4.0`, &Person{Age: 22}, Opt{}, 5.5, nil},
+		{`/Age + 1.5`, &Person{Age: 22}, Opt{Strict: true}, nil, mismatchErr},
+		{`/Count + 1`, &Counter{Count: 5}, Opt{}, int64(6), nil},
+		{`/Count div 2`, &Counter{Count: 5}, Opt{}, int64(2), nil},
+		{`/Count + 0.5`, &Counter{Count: 5}, Opt{}, 5.5, nil},
+		{`/Size * /Size`, &Counter{Size: 200}, Opt{}, int64(40000), nil},
+		{`-/Count`, &Counter{Count: 5}, Opt{}, int64(-5), nil},
+		{`-/Size`, &Counter{Size: 5}, Opt{}, int64(-5), nil},
+		{`sum(/Kids, /Count)`, &Counter{Kids: []Counter{Counter{Count: 2}, Counter{Count: 3}}}, Opt{}, int64(5), nil},
+		{`sum(/Kids, /Size)`, &Counter{Kids: []Counter{Counter{Size: 200}, Counter{Size: 200}}}, Opt{}, int64(400), nil},
+		{`avg(/Kids, /Count)`, &Counter{Kids: []Counter{Counter{Count: 2}, Counter{Count: 3}}}, Opt{}, 2.5, nil},
+		{`max(/Kids, /Count)`, &Counter{Kids: []Counter{Counter{Count: 2}, Counter{Count: 3}}}, Opt{}, int64(3), nil},
+		{`min(/Kids, /Size)`, &Counter{Kids: []Counter{Counter{Size: 9}, Counter{Size: 4}}}, Opt{}, uint8(4), nil},
+		{`/Kids orderBy /Count`, &Counter{Kids: []Counter{Counter{Name: "a", Count: 3}, Counter{Name: "b", Count: -1}, Counter{Name: "c", Count: 2}}}, Opt{},
+			[]Counter{Counter{Name: "b", Count: -1}, Counter{Name: "c", Count: 2}, Counter{Name: "a", Count: 3}}, nil},
+		{`/Kids orderBy /Size desc`, &Counter{Kids: []Counter{Counter{Name: "a", Size: 1}, Counter{Name: "b", Size: 200}}}, Opt{},
+			[]Counter{Counter{Name: "b", Size: 200}, Counter{Name: "a", Size: 1}}, nil},
+		{`/Kids limit /Count`, &Counter{Count: 1, Kids: []Counter{Counter{Name: "a"}, Counter{Name: "b"}}}, Opt{}, []Counter{Counter{Name: "a"}}, nil},
+		// Ignore case prefers an exact match, and strict mode won't guess between others
+		{`/userid`, map[string]interface{}{"userId": 1}, Opt{IgnoreCase: true}, 1, nil},
+		{`/userid`, map[string]int{"UserID": 1}, Opt{IgnoreCase: true}, 1, nil},
+		{`/userid`, map[string]interface{}{"userId": 1, "UserID": 2}, Opt{IgnoreCase: true}, 2, nil},
+		{`/userid`, map[string]interface{}{"userId": 1, "UserID": 2, "USERID": 3, "x": 4}, Opt{IgnoreCase: true}, 3, nil},
+		{`/userid`, map[string]interface{}{"userId": 1, "UserID": 2}, Opt{IgnoreCase: true, Strict: true}, nil, evalErr},
+		{`/userId`, map[string]interface{}{"userId": 1, "UserID": 2}, Opt{IgnoreCase: true, Strict: true}, 1, nil},
+		{`/userid`, &Partner{UserID: "a", UserId: "b"}, Opt{IgnoreCase: true}, "a", nil},
+		{`/userid`, &Partner{UserID: "a", UserId: "b"}, Opt{IgnoreCase: true, Strict: true}, nil, evalErr},
+		{`/UserId`, &Partner{UserID: "a", UserId: "b"}, Opt{IgnoreCase: true, Strict: true}, "b", nil},
+		// Getter methods, on value and pointer receivers, only if they're allowed
+		{`/Mom/Title`, &Person{Mom: Relative{Name: "Ana"}}, Opt{Methods: true}, "Ms. Ana", nil},
+		{`/Initial`, &Person{Name: "Ana"}, Opt{Methods: true}, "A", nil},
+		{`/Initial`, Person{Name: "Ana"}, Opt{Methods: true}, "A", nil},
+		{`/Initial`, &Person{}, Opt{Methods: true}, nil, evalErr},
+		{`/Initial`, &Person{Name: "Ana"}, Opt{}, nil, evalErr},
+		{`/Close`, &Counter{}, Opt{Methods: true}, nil, evalErr},
+		{`/Children/Initial`, &Person{Children: []Person{Person{Name: "a"}, Person{Name: "b"}}}, Opt{Methods: true}, []string{"a", "b"}, nil},
+		{`/Children/(/Initial == "b")/Age`, &Person{Children: []Person{Person{Name: "a", Age: 1}, Person{Name: "b", Age: 2}}}, Opt{Methods: true}, []int{2}, nil},
+		// Pointers and interfaces are followed, and nil mid-path is nil, unless strict
+		{`/Name`, (*Person)(nil), Opt{}, nil, nil},
+		{`/Name`, (*Person)(nil), Opt{Strict: true}, nil, evalErr},
+		{`/Friends/Name`, &Person{Friends: []*Person{nil, &Person{Name: "a"}}}, Opt{}, []string{"a"}, nil},
+		{`/Friends/Name`, &Person{Friends: []*Person{nil, &Person{Name: "a"}}}, Opt{Strict: true}, nil, evalErr},
+		{`/Friends[0]/Name`, &Person{Friends: []*Person{nil}}, Opt{}, nil, nil},
+		{`/Friends[0]/Name`, &Person{Friends: []*Person{nil}}, Opt{Strict: true}, nil, evalErr},
+		{`/(/Age > 1)/Name`, &[]Person{Person{Name: "a", Age: 1}, Person{Name: "b", Age: 2}}, Opt{}, []string{"b"}, nil},
+		{`/Count + 1`, &Holder{Count: intPtr(2)}, Opt{}, 3, nil},
+		{`/Count == 2`, &Holder{Count: intPtr(2)}, Opt{Strict: true}, true, nil},
+		{`/Count == 2`, &Holder{}, Opt{}, false, nil},
+		{`/Names[0]`, &Holder{Names: &[]string{"a", "b"}}, Opt{}, "a", nil},
+		{`/Names[1:]`, &Holder{Names: &[]string{"a", "b"}}, Opt{}, []string{"b"}, nil},
+		{`/Any/Name`, &Holder{Any: &Person{Name: "x"}}, Opt{}, "x", nil},
+		{`/Any/Name`, &Holder{}, Opt{}, nil, nil},
+		{`/Any/Name`, &Holder{}, Opt{Strict: true}, nil, evalErr},
+		{`/City`, &Holder{}, Opt{}, nil, nil},
+		{`/City`, &Holder{Address: &Address{City: "Oslo"}}, Opt{}, "Oslo", nil},
+		{`/a`, map[Key]int{"a": 1}, Opt{}, 1, nil},
+		// Map keys are converted to the key type
+		{`/2`, map[int8]string{2: "b"}, Opt{}, "b", nil},
+		{`/2`, map[uint]string{2: "b"}, Opt{}, "b", nil},
+		{`[-1]`, map[int]string{-1: "z"}, Opt{}, "z", nil},
+		{`/x`, map[int]string{2: "b"}, Opt{}, nil, nil},
+		{`/true`, map[bool]string{true: "y"}, Opt{}, "y", nil},
+		{`/a`, map[Upper]int{"A": 1}, Opt{}, 1, nil},
+		{`/1`, map[interface{}]interface{}{1: "i", "1": "s"}, Opt{}, "s", nil},
+		{`/1`, map[interface{}]interface{}{1: "i", "2": "s"}, Opt{}, "i", nil},
+		{`/1/b`, map[interface{}]interface{}{1: map[interface{}]interface{}{"b": 2}}, Opt{}, 2, nil},
+		{`//b`, map[interface{}]interface{}{1: map[interface{}]interface{}{"b": 2}}, Opt{}, []int{2}, nil},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			runTestExpr(t, tc.ExprInput, tc.EvalInput, tc.Opts, tc.WantResp, tc.WantErr)
+		})
+	}
+}
+
 func runTestExpr(t *testing.T, exprinput string, evalinput interface{}, opt Opt, wantResp interface{}, wantErr error) {
 	expr, err := MakeExpr(exprinput)
 	if err != nil {
@@ -224,6 +666,242 @@ func runTestExpr(t *testing.T, exprinput string, evalinput interface{}, opt Opt,
 	}
 }
 
+// ------------------------------------------------------------
+// TEST-EVAL-NEVER-PANICS
+
+func TestEvalNeverPanics(t *testing.T) {
+	exprs := []string{`/Name`, `/Mom/Name`, `/Friends/Name`, `/Friends[0]/Age`, `/Children[1:]`, `/(/Age > 1)`,
+		`/*`, `//Name`, `/Age + 1`, `!/Name`, `/Name = "a"`, `/Friends/Age = 1`, `/Initial`, `/Friends orderBy /Age limit 1`,
+		`count(/Friends, /Age)`, `/a/b[0]`, `/(@key == 1)`, `/City`, `/Names[0]`, `groupBy(/Friends, /Name)`, `distinct(/Friends)`,
+		`groupBy(/items, /k)`}
+	inputs := []interface{}{nil, (*Person)(nil), Person{}, &Person{Friends: []*Person{nil}}, &[]*Person{nil},
+		[]interface{}{nil, 1}, map[int]string{1: "a"}, map[string]interface{}{"a": nil}, (map[string]int)(nil),
+		make(chan int), func() {}, 3, "s", &Holder{}, &Holder{Any: (*Person)(nil)}, struct{ name string }{"a"},
+		jsonInput(`{"items": [{"k": "a"}, {"k": ["a"]}, {"k": {"a": 1}}]}`)}
+	for _, e := range exprs {
+		expr, err := MakeExpr(e)
+		if err != nil {
+			t.Fatal(e, err)
+		}
+		for i, input := range inputs {
+			for _, opt := range []*Opt{&Opt{}, &Opt{Strict: true}, &Opt{IgnoreCase: true, Tag: "json", Methods: true}} {
+				// Eval() recovers from panics, so evaluate the AST directly.
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatal(e, "panicked on input", i, r)
+						}
+					}()
+					expr.(*exprT).ast.Eval(input, opt, scopeT{})
+				}()
+				if _, err := expr.Eval(input, opt); err != nil && strings.Contains(err.Error(), "recovered from") {
+					t.Fatal(e, "panicked on input", i, err)
+				}
+			}
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-ASSIGN
+
+func TestAssign(t *testing.T) {
+	cases := []struct {
+		ExprInput string
+		EvalInput interface{}
+		Opts      Opt
+		WantResp  interface{}
+		WantErr   error
+		WantInput interface{}
+	}{
+		{`/Mom/Name = "Ana"`, &Person{}, Opt{}, 1, nil, &Person{Mom: Relative{Name: "Ana"}}},
+		{`/Name = /Mom/Name`, &Person{Mom: Relative{Name: "Ana"}}, Opt{}, 1, nil, &Person{Name: "Ana", Mom: Relative{Name: "Ana"}}},
+		{`/Age = 22.0`, &Person{}, Opt{}, 1, nil, &Person{Age: 22}},
+		{`/Age = 22.0`, &Person{}, Opt{Strict: true}, 0, mismatchErr, &Person{}},
+		{`/Count = 2.0`, &Counter{}, Opt{}, 1, nil, &Counter{Count: 2}},
+		{`/Size = 300`, &Counter{}, Opt{}, 0, mismatchErr, &Counter{}},
+		{`/Size = -1`, &Counter{}, Opt{}, 0, mismatchErr, &Counter{}},
+		{`/Kids/Count = 2.5`, &Counter{Kids: []Counter{Counter{}}}, Opt{}, 0, mismatchErr, &Counter{Kids: []Counter{Counter{}}}},
+		{`/a = 300`, map[string]int8{}, Opt{}, 0, mismatchErr, map[string]int8{}},
+		{`/Children/(/Age == 3)/Name = "toddler"`, &Person{Children: []Person{Person{Age: 3}, Person{Age: 5}, Person{Age: 3}}}, Opt{}, 2, nil,
+			&Person{Children: []Person{Person{Name: "toddler", Age: 3}, Person{Age: 5}, Person{Name: "toddler", Age: 3}}}},
+		{`/Children[-1]/Name = "c"`, &Person{Children: []Person{Person{}, Person{}}}, Opt{}, 1, nil, &Person{Children: []Person{Person{}, Person{Name: "c"}}}},
+		{`/Friends/(/Age > 1)/Age = 1`, &Person{Friends: []*Person{&Person{Age: 2}}}, Opt{}, 1, nil, &Person{Friends: []*Person{&Person{Age: 1}}}},
+		{`/Children/Name = "x"`, &Person{Children: []Person{Person{}, Person{}}}, Opt{}, 2, nil, &Person{Children: []Person{Person{Name: "x"}, Person{Name: "x"}}}},
+		// Maps
+		{`/a = "b"`, map[string]string{"a": "a"}, Opt{}, 1, nil, map[string]string{"a": "b"}},
+		{`/a/b = 2`, map[string]interface{}{"a": map[string]interface{}{"b": 1}}, Opt{}, 1, nil, map[string]interface{}{"a": map[string]interface{}{"b": 2}}},
+		{`/a/(/b == 1)/c = "x"`, map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": 1}, map[string]interface{}{"b": 2}}}, Opt{}, 1, nil,
+			map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": 1, "c": "x"}, map[string]interface{}{"b": 2}}}},
+		{`/a/(@key == "x")/Name = "y"`, map[string]interface{}{"a": map[string]*Person{"x": &Person{}, "z": &Person{}}}, Opt{}, 1, nil,
+			map[string]interface{}{"a": map[string]*Person{"x": &Person{Name: "y"}, "z": &Person{}}}},
+		{`/(@value > 1) = 0`, map[string]int{"a": 1, "b": 2, "c": 3}, Opt{}, 2, nil, map[string]int{"a": 1, "b": 0, "c": 0}},
+		{`/3 = "d"`, map[int]string{3: "c"}, Opt{}, 1, nil, map[int]string{3: "d"}},
+		{`[4] = "d"`, map[int]string{3: "c"}, Opt{}, 1, nil, map[int]string{3: "c", 4: "d"}},
+		{`/1/b = 3`, map[interface{}]interface{}{1: map[interface{}]interface{}{"b": 2}}, Opt{}, 1, nil, map[interface{}]interface{}{1: map[interface{}]interface{}{"b": 3}}},
+		// Ignore case assigns to the existing key
+		{`/userid = 2`, map[string]int{"userId": 1}, Opt{IgnoreCase: true}, 1, nil, map[string]int{"userId": 2}},
+		{`/name = "Ana"`, &Person{}, Opt{IgnoreCase: true}, 1, nil, &Person{Name: "Ana"}},
+		// Errors
+		{`/Name = "Ana"`, Person{}, Opt{}, 0, evalErr, Person{}},
+		{`/a/Name = "Ana"`, map[string]Relative{"a": Relative{}}, Opt{}, 0, evalErr, map[string]Relative{"a": Relative{}}},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			runTestExpr(t, tc.ExprInput, tc.EvalInput, tc.Opts, tc.WantResp, tc.WantErr)
+			if !interfaceMatches(tc.EvalInput, tc.WantInput) {
+				fmt.Println("Input mismatch, have\n", toJsonString(tc.EvalInput), "\nwant\n", toJsonString(tc.WantInput))
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-FUNCS
+
+func TestFuncs(t *testing.T) {
+	err := RegisterFunc("testDouble", func(i int) int { return i * 2 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := NewFuncs()
+	funcs.Add("testJoin", func(sep string, s ...string) string { return strings.Join(s, sep) })
+	funcs.Add("testFail", func() (int, error) { return 0, errors.New("fail") })
+	funcs.Add("testSmall", func(i int8) int8 { return i })
+	funcs.Add("testEach", func(items []interface{}, e Expr) ([]interface{}, error) {
+		var ans []interface{}
+		for _, item := range items {
+			v, err := e.Eval(item, nil)
+			if err != nil {
+				return nil, err
+			}
+			ans = append(ans, v)
+		}
+		return ans, nil
+	})
+	input0 := &Person{Name: "Ana", Age: 22}
+	input1 := []interface{}{map[string]interface{}{"Name": "a"}, map[string]interface{}{"Name": "b"}}
+
+	cases := []struct {
+		ExprInput string
+		EvalInput interface{}
+		Opts      Opt
+		WantResp  interface{}
+		WantErr   error
+	}{
+		{`testDouble(/Age)`, input0, Opt{}, 44, nil},
+		{`testDouble(2.0)`, input0, Opt{}, 4, nil},
+		{`testJoin("-", /Name, "b", "c")`, input0, Opt{Funcs: funcs}, "Ana-b-c", nil},
+		{`testJoin("-")`, input0, Opt{Funcs: funcs}, "", nil},
+		{`testEach([0:], /Name)`, input1, Opt{Funcs: funcs}, []interface{}{"a", "b"}, nil},
+		// Errors
+		{`testDouble(/Age)`, input0, Opt{Strict: true}, 44, nil},
+		{`testDouble(/Name)`, input0, Opt{}, nil, mismatchErr},
+		{`testFail()`, input0, Opt{Funcs: funcs}, nil, evalErr},
+		{`testDouble()`, input0, Opt{}, nil, parseErr},
+		{`testDouble("a")`, input0, Opt{}, nil, parseErr},
+		{`testDouble(2.9)`, input0, Opt{}, nil, parseErr},
+		{`testSmall(300)`, input0, Opt{Funcs: funcs}, nil, parseErr},
+		{`testSmall(/Age * 10)`, input0, Opt{Funcs: funcs}, nil, mismatchErr},
+		{`testDouble(/Age + 0.5)`, input0, Opt{}, nil, mismatchErr},
+		{`testJoin()`, input0, Opt{Funcs: funcs}, nil, parseErr},
+		{`testJoin("-")`, input0, Opt{}, nil, parseErr},
+		{`testUnknown(/Age)`, input0, Opt{}, nil, parseErr},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveResp, haveErr := Eval(tc.ExprInput, tc.EvalInput, &tc.Opts)
+			if !errorMatches(haveErr, tc.WantErr) {
+				fmt.Println("Error mismatch, have\n", haveErr, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			} else if !interfaceMatches(haveResp, tc.WantResp) {
+				fmt.Println("Response mismatch, have\n", haveResp, "\nwant\n", tc.WantResp)
+				t.Fatal()
+			}
+		})
+	}
+
+	// Function args must be funcs that answer a value
+	if RegisterFunc("testBad", 10) == nil || RegisterFunc("testBad", func() {}) == nil || RegisterFunc("testBad", func() (int, int) { return 0, 0 }) == nil {
+		t.Fatal("invalid funcs must not register")
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-CACHE
+
+func TestCache(t *testing.T) {
+	c := NewCache(2)
+	a0, _ := c.MakeExpr(`/a`, nil)
+	b0, _ := c.MakeExpr(`/b`, nil)
+	a1, _ := c.MakeExpr(`/a`, nil)
+	if a0 != a1 || c.Len() != 2 {
+		t.Fatal("expected /a to be cached")
+	}
+	// /b is the least recently used, so it's dropped.
+	c.MakeExpr(`/c`, nil)
+	if b1, _ := c.MakeExpr(`/b`, nil); b0 == b1 {
+		t.Fatal("expected /b to be dropped")
+	}
+	if _, err := c.MakeExpr(`/a ==`, nil); err == nil || c.Len() != 2 {
+		t.Fatal("expected errors to not be cached")
+	}
+	c.Clear()
+	if c.Len() != 0 {
+		t.Fatal("expected an empty cache")
+	}
+
+	// Adding a function replaces expressions that were made with the old one.
+	funcs := NewFuncs()
+	funcs.Add("testCached", func() int { return 1 })
+	opt := &Opt{Funcs: funcs}
+	if v := EvalInt(`testCached()`, nil, opt); v != 1 {
+		t.Fatal("have", v, "want", 1)
+	}
+	funcs.Add("testCached", func() int { return 2 })
+	if v := EvalInt(`testCached()`, nil, opt); v != 2 {
+		t.Fatal("have", v, "want", 2)
+	}
+
+	// Lists are constants, but callers can't change them.
+	v, _ := Eval(`["a", ["b", "c"]]`, nil, nil)
+	v.([]interface{})[0] = "z"
+	v.([]interface{})[1].([]interface{})[0] = "z"
+	if v, _ := Eval(`["a", ["b", "c"]]`, nil, nil); toJsonString(v) != `["a",["b","c"]]` {
+		t.Fatal("have", v, "want", `["a",["b","c"]]`)
+	}
+	m0, m1 := map[string]interface{}{}, map[string]interface{}{}
+	Eval(`/Tags = ["a", "b"]`, m0, nil)
+	Eval(`/Tags[0] = "z"`, m0, nil)
+	Eval(`/Tags = ["a", "b"]`, m1, nil)
+	if toJsonString(m1) != `{"Tags":["a","b"]}` {
+		t.Fatal("have", m1, "want", `{"Tags":["a","b"]}`)
+	}
+
+	// Disabled, and concurrent use.
+	SetCache(nil)
+	if v := EvalString(`/Name`, &Person{Name: "Ana"}, nil); v != "Ana" {
+		t.Fatal("have", v, "want", "Ana")
+	}
+	SetCache(NewCache(DefaultCacheSize))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				term := fmt.Sprintf(`/Age + %d`, j%10)
+				if v := EvalInt(term, &Person{Age: i}, nil); v != i+j%10 {
+					t.Error("have", v, "want", i+j%10)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
 // ------------------------------------------------------------
 // TEST-EVAL-FLOAT64
 
@@ -284,6 +962,118 @@ func TestEvalInt(t *testing.T) {
 	}
 }
 
+// ------------------------------------------------------------
+// TEST-EVAL-AS
+
+func TestEvalAs(t *testing.T) {
+	input0 := &Person{Name: "Ana", Age: 32, Children: []Person{Person{Age: 3}, Person{Age: 5}}}
+	input1 := map[string]interface{}{"Age": 32.0, "Big": 300.0, "Half": 1.5, "Neg": -1.0,
+		"Names": []interface{}{"a", "b"}, "Ages": map[string]interface{}{"a": 1.0, "b": 2.0}}
+
+	cases := []struct {
+		Eval     func() (interface{}, error)
+		WantResp interface{}
+		WantErr  error
+	}{
+		{func() (interface{}, error) { return EvalAs[int](`/Age`, input0, nil) }, 32, nil},
+		{func() (interface{}, error) { return EvalAs[int](`/Age`, input1, nil) }, 32, nil},
+		{func() (interface{}, error) { return EvalAs[int64](`/Age`, input0, nil) }, int64(32), nil},
+		{func() (interface{}, error) { return EvalAs[float32](`/Age`, input0, nil) }, float32(32), nil},
+		{func() (interface{}, error) { return EvalAs[uint8](`/Big`, input1, nil) }, uint8(0), mismatchErr},
+		{func() (interface{}, error) { return EvalAs[int](`/Half`, input1, nil) }, 0, mismatchErr},
+		{func() (interface{}, error) { return EvalAs[uint](`/Neg`, input1, nil) }, uint(0), mismatchErr},
+		{func() (interface{}, error) { return EvalAs[float64](`/Age`, &Person{Age: 1<<53 + 1}, nil) }, 0.0, mismatchErr},
+		{func() (interface{}, error) { return EvalAs[float64](`/Age`, &Person{Age: 1 << 53}, nil) }, float64(1 << 53), nil},
+		{func() (interface{}, error) { return EvalAs[float32](`/Age`, &Person{Age: 1<<24 + 1}, nil) }, float32(0), mismatchErr},
+		{func() (interface{}, error) { return EvalAs[float32](`@value`, 0.1, nil) }, float32(0.1), nil},
+		{func() (interface{}, error) { return EvalAs[float32](`@value`, 1e300, nil) }, float32(0), mismatchErr},
+		{func() (interface{}, error) { return EvalAs[float64](`@value`, uint64(1<<63+1), nil) }, 0.0, mismatchErr},
+		{func() (interface{}, error) { return EvalAs[float64](`@value`, int64(-1<<63), nil) }, float64(-1 << 63), nil},
+		{func() (interface{}, error) { return EvalAs[string](`/Name`, input0, nil) }, "Ana", nil},
+		{func() (interface{}, error) { return EvalAs[string](`/Age`, input0, nil) }, "", mismatchErr},
+		{func() (interface{}, error) { return EvalAs[[]int](`/Children/Age`, input0, nil) }, []int{3, 5}, nil},
+		{func() (interface{}, error) { return EvalAs[[]float64](`/Children/Age`, input0, nil) }, []float64{3, 5}, nil},
+		{func() (interface{}, error) { return EvalAs[[]string](`/Names`, input1, nil) }, []string{"a", "b"}, nil},
+		{func() (interface{}, error) { return EvalAs[map[string]int](`/Ages`, input1, nil) }, map[string]int{"a": 1, "b": 2}, nil},
+		{func() (interface{}, error) { return EvalAs[[]string](`/Missing`, input1, nil) }, []string(nil), nil},
+		{func() (interface{}, error) { return EvalAs[int](`/Missing`, input1, nil) }, 0, mismatchErr},
+		{func() (interface{}, error) { return EvalAs[Person](`/Children[1]`, input0, nil) }, Person{Age: 5}, nil},
+		{func() (interface{}, error) { return EvalAs[int](`/NoAge`, input0, nil) }, 0, evalErr},
+		{func() (interface{}, error) { return EvalOr(`/Age`, input1, 7, nil) }, 32, nil},
+		{func() (interface{}, error) { return EvalOr(`/Half`, input1, 7, nil) }, 7, mismatchErr},
+		{func() (interface{}, error) { return EvalOr(`/NoAge`, input0, 7, nil) }, 7, evalErr},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveResp, haveErr := tc.Eval()
+			if !errorMatches(haveErr, tc.WantErr) {
+				fmt.Println("Error mismatch, have\n", haveErr, "\nwant\n", tc.WantErr)
+				t.Fatal()
+			} else if !reflect.DeepEqual(haveResp, tc.WantResp) {
+				fmt.Printf("Response mismatch, have\n %#v \nwant\n %#v\n", haveResp, tc.WantResp)
+				t.Fatal()
+			}
+		})
+	}
+}
+
+// ------------------------------------------------------------
+// TEST-EVAL-INTO
+
+func TestEvalInto(t *testing.T) {
+	input0 := &Person{Children: []Person{Person{Name: "a", Age: 3, Children: []Person{Person{Name: "c"}}}, Person{Name: "b", Age: 5}}}
+	input1 := map[string]interface{}{"people": []interface{}{
+		map[string]interface{}{"name": "a", "age": 3.0, "kids": []interface{}{map[string]interface{}{"name": "c"}}},
+		map[string]interface{}{"name": "b", "age": 1.5},
+	}}
+	type cyc struct {
+		Name string
+		Next *cyc
+	}
+	type cycDTO struct {
+		Name string
+		Next *cycDTO
+	}
+	cycle0 := &cyc{Name: "a"}
+	cycle0.Next = cycle0
+	shared := &cyc{Name: "s"}
+
+	cases := []struct {
+		Term     string
+		Input    interface{}
+		Opt      *Opt
+		Dst      interface{}
+		WantResp interface{}
+		WantErr  error
+		WantPath string
+	}{
+		{`/Children`, input0, nil, &[]Person{}, &input0.Children, nil, ""},
+		{`/Children`, input0, nil, &[]PersonDTO{},
+			&[]PersonDTO{PersonDTO{Name: "a", Age: 3, Children: []KidDTO{KidDTO{Name: "c"}}}, PersonDTO{Name: "b", Age: 5}}, nil, ""},
+		{`/Children/(/Age > 4)`, input0, nil, &[]*KidDTO{}, &[]*KidDTO{&KidDTO{Name: "b"}}, nil, ""},
+		{`/people[0]`, input1, &Opt{Tag: "json"}, &PersonDTO{},
+			&PersonDTO{Name: "a", Age: 3, Children: []KidDTO{KidDTO{Name: "c"}}}, nil, ""},
+		{`/people`, input1, &Opt{Tag: "json"}, &[]PersonDTO{}, &[]PersonDTO{}, mismatchErr, "[1].age"},
+		{`/people[0]`, input1, &Opt{IgnoreCase: true}, &KidDTO{}, &KidDTO{Name: "a"}, nil, ""},
+		{`/Children`, input0, nil, nil, nil, badRequestErr, ""},
+		// Cycles are errors, but shared references aren't
+		{`/Next`, cycle0, nil, &cycDTO{}, &cycDTO{}, mismatchErr, ".Next"},
+		{`@value`, []*cyc{shared, shared}, nil, &[]cycDTO{}, &[]cycDTO{cycDTO{Name: "s"}, cycDTO{Name: "s"}}, nil, ""},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			haveErr := EvalInto(tc.Term, tc.Input, tc.Dst, tc.Opt)
+			if !errorMatches(haveErr, tc.WantErr) || (haveErr != nil && !strings.Contains(haveErr.Error(), tc.WantPath)) {
+				fmt.Println("Error mismatch, have\n", haveErr, "\nwant\n", tc.WantErr, tc.WantPath)
+				t.Fatal()
+			} else if !reflect.DeepEqual(tc.Dst, tc.WantResp) {
+				fmt.Printf("Response mismatch, have\n %#v \nwant\n %#v\n", tc.Dst, tc.WantResp)
+				t.Fatal()
+			}
+		})
+	}
+}
+
 // ------------------------------------------------------------
 // TEST-EVAL-STRING
 
@@ -411,6 +1201,111 @@ func TestEvalStringSlice(t *testing.T) {
 	}
 }
 
+// ------------------------------------------------------------
+// BENCHMARKS
+
+// Run with go test -run NONE -bench .
+func BenchmarkSelect100k(b *testing.B) {
+	input := benchPerson(100000)
+	expr, err := MakeExpr(`/Children/(/Age > 50)/Name`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchCheck(b, expr, input, nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr.Eval(input, nil)
+	}
+}
+
+func BenchmarkSelect100kTagged(b *testing.B) {
+	input := benchPerson(100000)
+	expr, err := MakeExpr(`/Children/(/age > 50)/name`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	opt := &Opt{Tag: "json", IgnoreCase: true}
+	benchCheck(b, expr, input, opt)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expr.Eval(input, opt)
+	}
+}
+
+func BenchmarkFieldByName(b *testing.B) {
+	v := reflect.ValueOf(Person{Name: "a", Age: 1})
+	for i := 0; i < b.N; i++ {
+		v.FieldByName("Age").Interface()
+	}
+}
+
+func BenchmarkFieldPlan(b *testing.B) {
+	v := reflect.ValueOf(Person{Name: "a", Age: 1})
+	n := &fieldNode{Field: "Age"}
+	opt := &Opt{}
+	for i := 0; i < b.N; i++ {
+		n.runOnValue(v, opt)
+	}
+}
+
+// BenchmarkSelect100kFieldByName does the field access of
+// /Children/(/Age > 50)/Name the way it was done before field plans,
+// by name for every item. Compare to BenchmarkSelect100kFieldPlan. These
+// are hand-written loops that measure only the field access, not the old
+// select path end to end, which no longer exists to run.
+func BenchmarkSelect100kFieldByName(b *testing.B) {
+	children := reflect.ValueOf(benchPerson(100000).Children)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var names []interface{}
+		for j := 0; j < children.Len(); j++ {
+			item := children.Index(j)
+			if item.FieldByName("Age").Interface().(int) > 50 {
+				names = append(names, item.FieldByName("Name").Interface())
+			}
+		}
+	}
+}
+
+// BenchmarkSelect100kFieldPlan does the field access of
+// /Children/(/Age > 50)/Name with field plans.
+func BenchmarkSelect100kFieldPlan(b *testing.B) {
+	children := reflect.ValueOf(benchPerson(100000).Children)
+	age, name := &fieldNode{Field: "Age"}, &fieldNode{Field: "Name"}
+	opt := &Opt{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var names []interface{}
+		for j := 0; j < children.Len(); j++ {
+			item := children.Index(j)
+			if v, _ := age.runOnValue(item, opt); v.(int) > 50 {
+				v, _ = name.runOnValue(item, opt)
+				names = append(names, v)
+			}
+		}
+	}
+}
+
+// benchCheck() fails the benchmark unless expr selects something, so a
+// broken expression can't look fast.
+func benchCheck(b *testing.B, expr Expr, input interface{}, opt *Opt) {
+	ans, err := expr.Eval(input, opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if v := reflect.ValueOf(ans); v.Kind() != reflect.Slice || v.Len() == 0 {
+		b.Fatal("expected a selection, have", ans)
+	}
+}
+
+func benchPerson(size int) *Person {
+	p := &Person{Children: make([]Person, size)}
+	for i := range p.Children {
+		p.Children[i] = Person{Name: strconv.Itoa(i), Age: i % 100}
+	}
+	return p
+}
+
 // ------------------------------------------------------------
 // MODEL
 
@@ -422,10 +1317,84 @@ type Person struct {
 	Friends  []*Person `json:"Friends,omitempty"`  // Test a pointer collection
 }
 
+type Account struct {
+	FirstName string `json:"first_name"`
+	Password  string `json:"-"`
+	Nick      string `json:",omitempty"`
+	Address
+	Friends []Account `json:"friends,omitempty"`
+}
+
+type PersonDTO struct {
+	Name     string   `json:"name"`
+	Age      int64    `json:"age"`
+	Children []KidDTO `json:"kids"`
+}
+
+type KidDTO struct {
+	Name string `json:"name"`
+}
+
+// Counter has numbers that aren't int or float64.
+type Counter struct {
+	Name  string
+	Count int64
+	Size  uint8
+	Kids  []Counter
+}
+
+type Holder struct {
+	Count *int
+	Names *[]string
+	Any   interface{}
+	*Address
+}
+
+type Key string
+
+// Upper is a map key that parses text as uppercase.
+type Upper string
+
+func (u *Upper) UnmarshalText(text []byte) error {
+	*u = Upper(strings.ToUpper(string(text)))
+	return nil
+}
+
+type Partner struct {
+	UserID string
+	UserId string
+}
+
+type Address struct {
+	City string `json:"city"`
+}
+
 type Relative struct {
 	Name string `json:"Name,omitempty"`
 }
 
+// ------------------------------------------------------------
+// MODEL GETTERS
+
+// Initial() answers the first letter of the name, testing getters
+// with a pointer receiver and an error.
+func (p *Person) Initial() (string, error) {
+	if p.Name == "" {
+		return "", errors.New("no name")
+	}
+	return p.Name[:1], nil
+}
+
+// Title() tests getters with a value receiver.
+func (r Relative) Title() string {
+	return "Ms. " + r.Name
+}
+
+// Close() tests that a method answering only an error isn't a getter.
+func (c *Counter) Close() error {
+	panic("Close() must not be called")
+}
+
 // ------------------------------------------------------------
 // MODEL BOILERPLATE
 
@@ -434,6 +1403,19 @@ func (p Person) MarshalJSON() ([]byte, error) {
 	return orderedMarshalJSON(p)
 }
 
+func intPtr(i int) *int {
+	return &i
+}
+
+// jsonInput() answers the hydrated json, panicking if it's malformed.
+func jsonInput(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
 // ------------------------------------------------------------
 // BUILD (tokens)
 
@@ -452,11 +1434,17 @@ func tokens(all ...interface{}) []*nodeT {
 			tokens = append(tokens, newNode(intToken, strconv.Itoa(v)))
 		case string:
 			tokens = append(tokens, newNode(stringToken, v).reclassify())
+		case *nodeT:
+			tokens = append(tokens, v)
 		}
 	}
 	return tokens
 }
 
+func andN(left, right *nodeT) *nodeT {
+	return binN(andToken, left, right)
+}
+
 func arrayN(left, right *nodeT) *nodeT {
 	return binN(openArrayToken, left, right)
 }
@@ -469,6 +1457,23 @@ func binN(sym symbol, left, right *nodeT) *nodeT {
 	return b
 }
 
+func callN(name string, args ...*nodeT) *nodeT {
+	n := newNode(callToken, name)
+	for _, a := range args {
+		n.addChild(a)
+	}
+	return n
+}
+
+func descN(left, right *nodeT) *nodeT {
+	b := newNode(descendToken, tokenMap[descendToken].Text)
+	b.addChild(left)
+	if right != nil {
+		b.addChild(right)
+	}
+	return b
+}
+
 func eqlN(left, right *nodeT) *nodeT {
 	return binN(eqlToken, left, right)
 }
@@ -482,10 +1487,63 @@ func intN(v int) *nodeT {
 	return newNode(intToken, strconv.Itoa(v))
 }
 
+func negN(child *nodeT) *nodeT {
+	n := newNode(negToken, tokenMap[negToken].Text)
+	n.addChild(child)
+	return n
+}
+
+func listN(items ...*nodeT) *nodeT {
+	n := newNode(listToken, "")
+	for _, item := range items {
+		n.addChild(item)
+	}
+	return n
+}
+
+func notN(child *nodeT) *nodeT {
+	n := newNode(notToken, tokenMap[notToken].Text)
+	n.addChild(child)
+	return n
+}
+
+func objN(pairs ...*nodeT) *nodeT {
+	n := newNode(objectToken, tokenMap[objectToken].Text)
+	for _, pair := range pairs {
+		n.addChild(pair)
+	}
+	return n
+}
+
+func pairN(key string, value *nodeT) *nodeT {
+	n := newNode(colonToken, tokenMap[colonToken].Text)
+	n.addChild(strN(key))
+	n.addChild(value)
+	return n
+}
+
+func orderN(left *nodeT, keys ...interface{}) *nodeT {
+	n := newNode(orderByToken, tokenMap[orderByToken].Text)
+	n.addChild(left)
+	for _, key := range keys {
+		switch t := key.(type) {
+		case string:
+			n.addChild(strN(t))
+		case *nodeT:
+			n.addChild(t)
+		}
+	}
+	return n
+}
+
 func orN(left, right *nodeT) *nodeT {
 	return binN(orToken, left, right)
 }
 
+func paramN(text string) *nodeT {
+	return newNode(paramToken, text)
+}
+
 func pathN(left, right *nodeT) *nodeT {
 	b := newNode(pathToken, tokenMap[pathToken].Text)
 	b.addChild(left)
@@ -499,6 +1557,18 @@ func selN(child *nodeT) *nodeT {
 	return mkUnary(selectToken, child)
 }
 
+// sliceN constructs slice params; nil values are omitted.
+func sliceN(start, end, step *nodeT) *nodeT {
+	n := newNode(sliceToken, "")
+	for _, c := range []*nodeT{start, end, step} {
+		if c == nil {
+			c = newNode(emptyToken, "")
+		}
+		n.addChild(c)
+	}
+	return n
+}
+
 func strN(text string) *nodeT {
 	return newNode(stringToken, text)
 }
@@ -1,5 +1,11 @@
 package sqi
 
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 // ------------------------------------------------------------
 // TOKEN-T
 
@@ -43,26 +49,49 @@ const (
 	// Special tokens
 	illegalToken symbol = iota
 	eofToken
+	emptyToken // An omitted value, such as a missing slice bound
 
 	// Raw values
 	intToken    // 12345
 	floatToken  // 123.45
 	stringToken // "abc"
+	paramToken  // $abc or ?
+	scopeToken  // @key or @value
 
 	// Assignment
 	assignToken // =
 
-	// Negation
-	negToken // -
+	// Ordering and limiting
+	orderByToken // orderBy
+	limitToken   // limit
+	offsetToken  // offset
+
+	// Arithmetic
+	negToken // - (negate or subtract)
+	addToken // +
+	divToken // div
+	modToken // %
 
 	// Building
-	pathToken // /
+	pathToken    // /
+	descendToken // //
+	starToken    // * (wildcard or multiply)
 
 	// Comparison
 	startComparison
 
 	eqlToken // ==
 	neqToken // !=
+	ltToken  // <
+	lteToken // <=
+	gtToken  // >
+	gteToken // >=
+
+	containsToken   // contains
+	startsWithToken // startsWith
+	endsWithToken   // endsWith
+	matchToken      // =~
+	inToken         // in
 
 	endComparison
 
@@ -71,6 +100,7 @@ const (
 
 	andToken // &&
 	orToken  // ||
+	notToken // ! or not
 
 	// -- END CONDITIONALS.
 	endConditional
@@ -84,45 +114,135 @@ const (
 	closeToken      // ) // All closes must be after the opens
 	closeArrayToken // ]
 
+	// Separators
+	colonToken // :
+	commaToken // ,
+
 	// True/false condition
 	selectToken
 
+	// Range of an array
+	sliceToken
+
+	// Function call
+	callToken
+
+	// List literal
+	listToken
+
+	// Object literal
+	objectToken      // {
+	closeObjectToken // }
+
 	// -- END UNARIES.
 	endUnary
 )
 
 var (
+	tokenMap   map[symbol]*tokenT
+	keywordMap map[string]*tokenT
+)
+
+// init() builds the token tables. This can't be a plain initialization
+// because some of the token funcs construct new nodes from the tables.
+func init() {
 	tokenMap = map[symbol]*tokenT{
-		illegalToken:    &tokenT{illegalToken, "", 0, emptyNud, emptyLed},
-		intToken:        &tokenT{intToken, "", 0, emptyNud, emptyLed},
-		floatToken:      &tokenT{floatToken, "", 0, emptyNud, emptyLed},
-		stringToken:     &tokenT{stringToken, "", 0, emptyNud, emptyLed},
-		assignToken:     &tokenT{assignToken, "=", 80, emptyNud, binaryLed},
-		negToken:        &tokenT{negToken, "", 0, emptyNud, emptyLed},
-		pathToken:       &tokenT{pathToken, "/", 90, pathNud, binaryLed},
-		eqlToken:        &tokenT{eqlToken, "==", 70, emptyNud, binaryLed},
-		neqToken:        &tokenT{neqToken, "!=", 70, emptyNud, binaryLed},
-		andToken:        &tokenT{andToken, "&&", 60, emptyNud, binaryLed},
-		orToken:         &tokenT{orToken, "||", 60, emptyNud, binaryLed},
-		openToken:       &tokenT{openToken, "(", 0, enclosedNud, emptyLed},
-		closeToken:      &tokenT{closeToken, ")", 0, emptyNud, emptyLed},
-		openArrayToken:  &tokenT{openArrayToken, "[", 85, arrayNud, arrayLed},
-		closeArrayToken: &tokenT{closeArrayToken, "]", 85, emptyNud, emptyLed},
-		selectToken:     &tokenT{selectToken, "", 100, emptyNud, emptyLed},
+		illegalToken:     &tokenT{illegalToken, "", 0, emptyNud, emptyLed},
+		emptyToken:       &tokenT{emptyToken, "", 0, emptyNud, emptyLed},
+		intToken:         &tokenT{intToken, "", 0, emptyNud, emptyLed},
+		floatToken:       &tokenT{floatToken, "", 0, emptyNud, emptyLed},
+		stringToken:      &tokenT{stringToken, "", 0, emptyNud, emptyLed},
+		paramToken:       &tokenT{paramToken, "?", 0, emptyNud, emptyLed},
+		scopeToken:       &tokenT{scopeToken, "@", 0, emptyNud, emptyLed},
+		assignToken:      &tokenT{assignToken, "=", 10, emptyNud, binaryLed},
+		orderByToken:     &tokenT{orderByToken, "orderBy", 20, wordNud, orderLed},
+		limitToken:       &tokenT{limitToken, "limit", 20, wordNud, binaryLed},
+		offsetToken:      &tokenT{offsetToken, "offset", 20, wordNud, binaryLed},
+		negToken:         &tokenT{negToken, "-", 74, prefixNud, binaryLed},
+		addToken:         &tokenT{addToken, "+", 74, emptyNud, binaryLed},
+		divToken:         &tokenT{divToken, "div", 76, wordNud, binaryLed},
+		modToken:         &tokenT{modToken, "%", 76, emptyNud, binaryLed},
+		pathToken:        &tokenT{pathToken, "/", 90, pathNud, binaryLed},
+		descendToken:     &tokenT{descendToken, "//", 90, pathNud, binaryLed},
+		starToken:        &tokenT{starToken, "*", 76, emptyNud, binaryLed},
+		eqlToken:         &tokenT{eqlToken, "==", 70, emptyNud, binaryLed},
+		neqToken:         &tokenT{neqToken, "!=", 70, emptyNud, binaryLed},
+		ltToken:          &tokenT{ltToken, "<", 70, emptyNud, binaryLed},
+		lteToken:         &tokenT{lteToken, "<=", 70, emptyNud, binaryLed},
+		gtToken:          &tokenT{gtToken, ">", 70, emptyNud, binaryLed},
+		gteToken:         &tokenT{gteToken, ">=", 70, emptyNud, binaryLed},
+		containsToken:    &tokenT{containsToken, "contains", 70, wordNud, binaryLed},
+		startsWithToken:  &tokenT{startsWithToken, "startsWith", 70, wordNud, binaryLed},
+		endsWithToken:    &tokenT{endsWithToken, "endsWith", 70, wordNud, binaryLed},
+		matchToken:       &tokenT{matchToken, "=~", 70, emptyNud, binaryLed},
+		inToken:          &tokenT{inToken, "in", 70, wordNud, binaryLed},
+		andToken:         &tokenT{andToken, "&&", 60, emptyNud, binaryLed},
+		orToken:          &tokenT{orToken, "||", 60, emptyNud, binaryLed},
+		notToken:         &tokenT{notToken, "!", 0, prefixNud, emptyLed},
+		openToken:        &tokenT{openToken, "(", 88, enclosedNud, callLed},
+		closeToken:       &tokenT{closeToken, ")", 0, emptyNud, emptyLed},
+		openArrayToken:   &tokenT{openArrayToken, "[", 85, arrayNud, arrayLed},
+		closeArrayToken:  &tokenT{closeArrayToken, "]", 0, emptyNud, emptyLed},
+		colonToken:       &tokenT{colonToken, ":", 0, emptyNud, emptyLed},
+		commaToken:       &tokenT{commaToken, ",", 0, emptyNud, emptyLed},
+		selectToken:      &tokenT{selectToken, "", 100, emptyNud, emptyLed},
+		sliceToken:       &tokenT{sliceToken, "", 0, emptyNud, emptyLed},
+		callToken:        &tokenT{callToken, "", 0, emptyNud, emptyLed},
+		listToken:        &tokenT{listToken, "", 0, emptyNud, emptyLed},
+		objectToken:      &tokenT{objectToken, "{", 0, objectNud, emptyLed},
+		closeObjectToken: &tokenT{closeObjectToken, "}", 0, emptyNud, emptyLed},
 	}
 	keywordMap = map[string]*tokenT{
-		`=`:  tokenMap[assignToken],
-		`-`:  tokenMap[negToken],
-		`/`:  tokenMap[pathToken],
-		`==`: tokenMap[eqlToken],
-		`!=`: tokenMap[neqToken],
-		`&&`: tokenMap[andToken],
-		`||`: tokenMap[orToken],
-		`(`:  tokenMap[openToken],
-		`)`:  tokenMap[closeToken],
-		`[`:  tokenMap[openArrayToken],
-		`]`:  tokenMap[closeArrayToken],
+		`=`:          tokenMap[assignToken],
+		`orderBy`:    tokenMap[orderByToken],
+		`limit`:      tokenMap[limitToken],
+		`offset`:     tokenMap[offsetToken],
+		`-`:          tokenMap[negToken],
+		`+`:          tokenMap[addToken],
+		`div`:        tokenMap[divToken],
+		`%`:          tokenMap[modToken],
+		`/`:          tokenMap[pathToken],
+		`//`:         tokenMap[descendToken],
+		`*`:          tokenMap[starToken],
+		`==`:         tokenMap[eqlToken],
+		`!=`:         tokenMap[neqToken],
+		`<`:          tokenMap[ltToken],
+		`<=`:         tokenMap[lteToken],
+		`>`:          tokenMap[gtToken],
+		`>=`:         tokenMap[gteToken],
+		`contains`:   tokenMap[containsToken],
+		`startsWith`: tokenMap[startsWithToken],
+		`endsWith`:   tokenMap[endsWithToken],
+		`=~`:         tokenMap[matchToken],
+		`in`:         tokenMap[inToken],
+		`&&`:         tokenMap[andToken],
+		`||`:         tokenMap[orToken],
+		`!`:          tokenMap[notToken],
+		`not`:        tokenMap[notToken],
+		`(`:          tokenMap[openToken],
+		`)`:          tokenMap[closeToken],
+		`[`:          tokenMap[openArrayToken],
+		`]`:          tokenMap[closeArrayToken],
+		`{`:          tokenMap[objectToken],
+		`}`:          tokenMap[closeObjectToken],
+		`:`:          tokenMap[colonToken],
+		`,`:          tokenMap[commaToken],
+		`?`:          tokenMap[paramToken],
 	}
+}
+
+const (
+	// Ordering directions
+	ascText  = "asc"
+	descText = "desc"
+
+	// Pseudo-fields
+	scopeKeyText   = "@key"
+	scopeValueText = "@value"
+
+	// unaryBindingPower is used to parse the operand of prefix operators.
+	// It binds tighter than everything but paths and arrays.
+	unaryBindingPower = 80
 )
 
 // ------------------------------------------------------------
@@ -155,6 +275,22 @@ func pathLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
 	return n, nil
 }
 
+// wordNud() answers operators spelled as words as plain strings when
+// they appear where a value is expected, so they can still name fields.
+func wordNud(n *nodeT, p *parserT) (*nodeT, error) {
+	return newNode(stringToken, n.Text), nil
+}
+
+// prefixNud() parses the operand of a prefix operator, such as negate or not.
+func prefixNud(n *nodeT, p *parserT) (*nodeT, error) {
+	right, err := p.Expression(unaryBindingPower)
+	if err != nil {
+		return nil, err
+	}
+	n.addChild(right)
+	return n, nil
+}
+
 func binaryLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
 	n.addChild(left)
 	right, err := p.Expression(n.Token.BindingPower)
@@ -165,8 +301,34 @@ func binaryLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
 	return n, nil
 }
 
+// orderLed() parses the keys of an ordering: a comma-separated list of
+// expressions, each optionally followed by asc or desc. The children
+// are the left followed by each key and its direction.
+func orderLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
+	n.addChild(left)
+	for {
+		key, err := p.Expression(n.Token.BindingPower)
+		if err != nil {
+			return nil, err
+		}
+		dir := ascText
+		next := p.Peek()
+		if next.Token.Symbol == stringToken && (next.Text == ascText || next.Text == descText) {
+			p.Next()
+			dir = next.Text
+		}
+		n.addChild(key)
+		n.addChild(newNode(stringToken, dir))
+		if p.Peek().Token.Symbol != commaToken {
+			return n, nil
+		}
+		p.Next()
+	}
+}
+
 func enclosedNud(n *nodeT, p *parserT) (*nodeT, error) {
-	enclosed, err := p.Expression(n.Token.BindingPower)
+	// My binding power applies to function calls, not my contents.
+	enclosed, err := p.Expression(0)
 	if err != nil {
 		return nil, err
 	}
@@ -183,37 +345,194 @@ func enclosedNud(n *nodeT, p *parserT) (*nodeT, error) {
 	return enclosed, nil
 }
 
-func arrayNud(n *nodeT, p *parserT) (*nodeT, error) {
-	right, err := p.Expression(n.Token.BindingPower)
-	if err != nil {
-		return nil, err
+// callLed() parses a function call. The left must be the function name.
+func callLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
+	if left.Token.Symbol != stringToken || len(left.Children) != 0 || strings.HasPrefix(left.Text, `"`) {
+		return nil, newParseError("can't call " + left.Text)
 	}
-	next, err := p.Next()
+	call := newNode(callToken, left.Text)
+	if p.Peek().Token.Symbol == closeToken {
+		p.Next()
+		return call, nil
+	}
+	for {
+		arg, err := p.Expression(0)
+		if err != nil {
+			return nil, err
+		}
+		call.addChild(arg)
+		next, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, newParseError("missing close for " + left.Text)
+		}
+		switch next.Token.Symbol {
+		case closeToken:
+			return call, nil
+		case commaToken:
+		default:
+			return nil, newParseError("unexpected " + next.Text + " in " + left.Text)
+		}
+	}
+}
+
+// arrayNud() parses an array operator on the current input, or a list literal.
+func arrayNud(n *nodeT, p *parserT) (*nodeT, error) {
+	right, err := arrayIndex(n, p)
 	if err != nil {
 		return nil, err
 	}
-	if next.Token.Symbol != closeArrayToken {
-		return nil, newParseError("missing close for " + n.Text)
+	if right.Token.Symbol == listToken {
+		return right, nil
 	}
-
 	n.addChild(right)
 	return n, nil
 }
 
 func arrayLed(n *nodeT, p *parserT, left *nodeT) (*nodeT, error) {
-	right, err := p.Expression(n.Token.BindingPower)
+	right, err := arrayIndex(n, p)
 	if err != nil {
 		return nil, err
 	}
-	next, err := p.Next()
-	if err != nil {
-		return nil, err
-	}
-	if next.Token.Symbol != closeArrayToken {
-		return nil, newParseError("missing close for " + n.Text)
+	if right.Token.Symbol == listToken {
+		return nil, newParseError("can't index with list")
 	}
-
 	n.addChild(left)
 	n.addChild(right)
 	return n, nil
 }
+
+// arrayIndex() parses the contents of an array operator, including the close.
+// The contents are either a single index or a slice in the form [start:end:step],
+// where each part of the slice is optional. Contents separated by commas are a
+// list literal, which can end with a comma so a single item can be listed.
+func arrayIndex(n *nodeT, p *parserT) (*nodeT, error) {
+	var parts []*nodeT
+	var part *nodeT
+	var list *nodeT
+	var err error
+	for {
+		next := p.Peek()
+		if next.Token.Symbol == illegalToken {
+			return nil, newParseError("missing close for " + n.Text)
+		}
+		if next.Token.Symbol == commaToken || list != nil && next.Token.Symbol == closeArrayToken {
+			p.Next()
+			if list == nil {
+				if len(parts) > 0 {
+					return nil, newParseError("unexpected " + next.Text + " in slice")
+				}
+				list = newNode(listToken, "")
+			}
+			if part != nil {
+				list.addChild(part)
+			} else if next.Token.Symbol == commaToken {
+				return nil, newParseError("missing item in list")
+			}
+			part = nil
+			if next.Token.Symbol == closeArrayToken {
+				return list, nil
+			}
+			continue
+		}
+		if next.Token.any(colonToken, closeArrayToken) {
+			if list != nil {
+				return nil, newParseError("unexpected " + next.Text + " in list")
+			}
+			p.Next()
+			parts = append(parts, part)
+			part = nil
+			if next.Token.Symbol == closeArrayToken {
+				break
+			}
+			continue
+		}
+		if part != nil {
+			return nil, newParseError("unexpected " + next.Text + " in " + n.Text)
+		}
+		part, err = p.Expression(n.Token.BindingPower)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(parts) == 1 {
+		if parts[0] == nil {
+			return nil, newParseError("missing index for " + n.Text)
+		}
+		return parts[0], nil
+	}
+	if len(parts) > 3 {
+		return nil, newParseError("slice has too many parts")
+	}
+	slice := newNode(sliceToken, "")
+	for i := 0; i < 3; i++ {
+		if i < len(parts) && parts[i] != nil {
+			slice.addChild(parts[i])
+		} else {
+			slice.addChild(newNode(emptyToken, ""))
+		}
+	}
+	return slice, nil
+}
+
+// objectNud() parses an object literal in the form {key: value, ...}. Each
+// pair is a colon node with the key and value as children.
+func objectNud(n *nodeT, p *parserT) (*nodeT, error) {
+	for {
+		key, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return nil, newParseError("missing close for " + n.Text)
+		}
+		if key.Token.Symbol == closeObjectToken {
+			return n, nil
+		}
+		if !isObjectKey(key) {
+			return nil, newParseError("object key can't be " + key.Text)
+		}
+		colon, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		if colon == nil || colon.Token.Symbol != colonToken {
+			return nil, newParseError("missing : after " + key.Text)
+		}
+		value, err := p.Expression(0)
+		if err != nil {
+			return nil, err
+		}
+		colon.addChild(newNode(stringToken, key.Text))
+		colon.addChild(value)
+		n.addChild(colon)
+
+		next, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, newParseError("missing close for " + n.Text)
+		}
+		switch next.Token.Symbol {
+		case closeObjectToken:
+			return n, nil
+		case commaToken:
+		default:
+			return nil, newParseError("unexpected " + next.Text + " in " + n.Text)
+		}
+	}
+}
+
+// isObjectKey() answers true if n can name an object key: a string,
+// or an operator spelled as a word.
+func isObjectKey(n *nodeT) bool {
+	if n.Token.Symbol == stringToken {
+		return len(n.Children) == 0
+	}
+	r, _ := utf8.DecodeRuneInString(n.Text)
+	return unicode.IsLetter(r)
+}